@@ -0,0 +1,100 @@
+package backtesting
+
+import (
+	"fmt"
+	"time"
+)
+
+// AbortRules stop a backtest as soon as it is hopeless, e.g. to prune the combos of a sweep. Zero values disable rules.
+type AbortRules struct {
+	// MaxDrawdownPct is the largest drop of closed-trade equity from its peak, the initial capital being the first peak.
+	MaxDrawdownPct float64 `json:",omitempty"` // in percent of the peak
+
+	// MinTrades is the number of trades which must have been opened once MinTradesAfter has elapsed since the start.
+	MinTrades      int           `json:",omitempty"`
+	MinTradesAfter time.Duration `json:",omitempty"`
+
+	// MaxConsecutiveLosses is the number of losing trades in a row, trades without profit counting as losses.
+	MaxConsecutiveLosses int `json:",omitempty"`
+}
+
+func (r *AbortRules) validate() error {
+	switch {
+	case r.MaxDrawdownPct < 0 || r.MaxDrawdownPct > 100:
+		return fmt.Errorf("max drawdown must be between 0 and 100%%, got %.2f", r.MaxDrawdownPct)
+	case r.MinTrades < 0 || r.MaxConsecutiveLosses < 0:
+		return fmt.Errorf("trade counts must not be negative")
+	case r.MinTrades > 0 && r.MinTradesAfter <= 0:
+		return fmt.Errorf("min trades needs a positive delay, got %s", r.MinTradesAfter)
+	}
+	return nil
+}
+
+// AbortedError is returned by Run when an abort rule stopped the backtest. Open positions are closed at that time.
+type AbortedError struct {
+	Time   time.Time
+	Reason string
+}
+
+func (e *AbortedError) Error() string {
+	return fmt.Sprintf("aborted at %s: %s", e.Time.Format("2006-01-02 15:04:05"), e.Reason)
+}
+
+func (b *broker) setupAbort() error {
+	if b.config.Abort != nil {
+		if err := b.config.Abort.validate(); err != nil {
+			return fmt.Errorf("invalid abort rules: %w", err)
+		}
+	}
+
+	b.abort = abortState{equity: b.config.InitialCapital, peak: b.config.InitialCapital}
+	if b.current != nil {
+		b.abort.start = b.current.Timestamp
+	}
+	return nil
+}
+
+// abortState follows the closed trades for the abort rules.
+type abortState struct {
+	start             time.Time
+	equity            float64 // Closed-trade equity, initial capital included
+	peak              float64
+	consecutiveLosses int
+}
+
+func (s *abortState) recordClose(pnl float64) {
+	s.equity += pnl
+	s.peak = max(s.peak, s.equity)
+	if pnl > 0 {
+		s.consecutiveLosses = 0
+	} else {
+		s.consecutiveLosses++
+	}
+}
+
+// checkAbort returns an AbortedError once a rule is broken, nil without rules.
+func (b *broker) checkAbort() error {
+	rules := b.config.Abort
+	if rules == nil {
+		return nil
+	}
+
+	s := b.abort
+	now := b.currentTick().Timestamp
+	var reason string
+
+	switch {
+	case rules.MaxDrawdownPct > 0 && s.peak > 0 && (s.peak-s.equity)/s.peak*100 >= rules.MaxDrawdownPct:
+		reason = fmt.Sprintf("drawdown of %.1f%% reached the limit of %.1f%%", (s.peak-s.equity)/s.peak*100, rules.MaxDrawdownPct)
+	case rules.MaxConsecutiveLosses > 0 && s.consecutiveLosses >= rules.MaxConsecutiveLosses:
+		reason = fmt.Sprintf("%d consecutive losses", s.consecutiveLosses)
+	case rules.MinTrades > 0 && now.Sub(s.start) >= rules.MinTradesAfter && len(b.positionsHistory) < rules.MinTrades:
+		reason = fmt.Sprintf("%d trades after %s, at least %d expected", len(b.positionsHistory), rules.MinTradesAfter, rules.MinTrades)
+	default:
+		return nil
+	}
+
+	log.Debug("🛑 Backtest aborted at %s: %s", now.Format("2006-01-02 15:04:05"), reason)
+	b.closeAllOpenPositions()
+	return &AbortedError{Time: now, Reason: reason}
+}
@@ -11,10 +11,27 @@ import (
 
 var log = common.NewLogger("backtesting")
 
+// EngineVersion must be bumped on any change of the engine which affects results, so that cached results are invalidated.
+const EngineVersion = 1
+
 type Config struct {
 	LotSize        int     // Size of the lot to trade
 	Leverage       float64 // Leverage to use for trading
 	InitialCapital float64 // Initial capital for the backtesting account
+
+	// Drive the backtest from M1 candles instead of ticks, see NewCandleBroker (omitted from the JSON when false, like
+	// Intrabar, so that keys of tick runs are kept)
+	Candles bool `json:",omitempty"`
+
+	// Candle mode only: how to resolve a candle where both stop loss and take profit are touched
+	Intrabar IntrabarResolution `json:",omitempty"`
+
+	// Trading costs, on top of the spread
+	Commission float64 // Commission per lot and per side, in account currency
+	Slippage   float64 // Adverse price move on every fill (open and close), in price units
+
+	// Rules stopping hopeless backtests early, none if nil (omitted from the JSON so that keys of existing runs are kept)
+	Abort *AbortRules `json:",omitempty"`
 }
 
 type Metrics struct {
@@ -38,6 +55,10 @@ type Metrics struct {
 	// Shows the worst-case capital exposure during the test.
 	MaxDrawdownPct float64 // in percent
 
+	// MaxDrawdown is the largest drop of closed-trade equity from a peak, the initial capital being the first peak.
+	// Expressed in base currency like NetPnL, e.g. to rank strategies by return over drawdown.
+	MaxDrawdown float64
+
 	// ExpectedValueR is the average return per trade in R-multiples.
 	// Helps understand the return relative to risk.
 	ExpectedValueR float64
@@ -56,20 +77,32 @@ type Metrics struct {
 type broker struct {
 	config           *Config
 	ticks            []tick
+	candles          *CandleDataset // Set in candle mode, where ticks are not replayed
 	currentIndex     int
+	current          *tick // Current quote, either a real tick or the close of the current candle
 	capital          float64
 	openPositions    map[*position]struct{}
 	callbacks        map[brokers.Timeframe][]func(candle brokers.Candle)
 	positionsHistory []*position
+	abort            abortState
 }
 
 // Run implements brokers.BacktestingBroker.
 func (b *broker) Run() error {
+	if b.candles != nil {
+		return b.runCandles()
+	}
+
 	log.Debug("🚀 Starting backtest with %d ticks and initial capital %.2f", len(b.ticks), b.capital)
 
 	for {
+		b.current = &b.ticks[b.currentIndex]
 		b.processTick()
 
+		if err := b.checkAbort(); err != nil {
+			return err
+		}
+
 		if b.currentIndex == len(b.ticks)-1 {
 			break
 		}
@@ -112,7 +145,7 @@ func (b *broker) RegisterMarketDataCallback(timeframe brokers.Timeframe, callbac
 
 // PlaceOrder implements brokers.Broker.
 func (b *broker) PlaceOrder(order *brokers.Order) (brokers.Position, error) {
-	pos := newPosition(b.currentTick(), b.GetCapital(), order)
+	pos := newPosition(b.currentTick(), b.GetCapital(), order, b.config)
 	margin := pos.getMargin(b.GetLeverage())
 
 	if margin > b.capital {
@@ -145,6 +178,39 @@ func NewBroker(config *Config, dataset *Dataset) (brokers.BacktestingBroker, err
 		positionsHistory: make([]*position, 0),
 	}
 
+	if len(b.ticks) > 0 {
+		b.current = &b.ticks[0]
+	}
+
+	if err := b.setupAbort(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// NewCandleBroker creates a new instance of the broker, driven by M1 candles instead of ticks.
+// This is much faster, at the cost of approximating fills inside candles (see Config.Intrabar).
+func NewCandleBroker(config *Config, dataset *CandleDataset) (brokers.BacktestingBroker, error) {
+	if len(dataset.candles) == 0 {
+		return nil, fmt.Errorf("candle dataset is empty")
+	}
+
+	b := &broker{
+		config:           config,
+		candles:          dataset,
+		capital:          config.InitialCapital,
+		openPositions:    make(map[*position]struct{}),
+		callbacks:        make(map[brokers.Timeframe][]func(candle brokers.Candle)),
+		positionsHistory: make([]*position, 0),
+	}
+
+	b.current = closeQuote(&dataset.candles[0])
+
+	if err := b.setupAbort(); err != nil {
+		return nil, err
+	}
+
 	return b, nil
 }
 
@@ -158,8 +224,18 @@ func ComputeMetrics(b brokers.BacktestingBroker) (map[common.Month]*Metrics, err
 	return metrics, nil
 }
 
+// ComputeTotalMetrics computes metrics over the whole backtest, instead of per month.
+func ComputeTotalMetrics(b brokers.BacktestingBroker) (*Metrics, error) {
+	bb, ok := b.(*broker)
+	if !ok {
+		return nil, fmt.Errorf("invalid broker type: expected *broker, got %T", b)
+	}
+
+	return bb.computePositionsMetrics(bb.positionsHistory), nil
+}
+
 func (b *broker) currentTick() *tick {
-	return &b.ticks[b.currentIndex]
+	return b.current
 }
 
 func (b *broker) printGap() {
@@ -172,7 +248,8 @@ func (b *broker) printGap() {
 		return
 	}
 
-	log.Warning("⏳ Gap detected at %s: Previous=%s, Difference=%s",
+	log.Warning("⏳ Gap (%s) detected at %s: Previous=%s, Difference=%s",
+		currentTick.GapKind,
 		currentTick.Timestamp.Format("2006-01-02 15:04:05"),
 		previousTick.Timestamp.Format("2006-01-02 15:04:05"),
 		currentTick.Timestamp.Sub(previousTick.Timestamp).String())
@@ -188,23 +265,17 @@ func (b *broker) processTick() {
 	}
 
 	for pos := range b.openPositions {
-		switch pos.isTriggered(currentTick) {
+		trigger := pos.isTriggered(currentTick)
+		switch trigger {
 		case CloseTriggerNone:
 			// Position is still open, do nothing
 			continue
 		case CloseTriggerStopLoss, CloseTriggerTakeProfit:
 			// Position should be closed
-			b.closePosition(pos)
-
-			closeReason := "unknown"
-			if pos.isTriggered(currentTick) == CloseTriggerStopLoss {
-				closeReason = "stop loss"
-			} else if pos.isTriggered(currentTick) == CloseTriggerTakeProfit {
-				closeReason = "take profit"
-			}
+			b.closePosition(pos, trigger)
 
 			log.Debug("📉 Position closed (%s) at %s: Direction=%s, Quantity=%d, OpenPrice=%.5f, ClosePrice=%.5f",
-				closeReason,
+				trigger,
 				currentTick.Timestamp.Format("2006-01-02 15:04:05"),
 				pos.direction, pos.quantity, pos.openPrice, pos.closePrice)
 		}
@@ -308,7 +379,7 @@ func (b *broker) cancelAllOpenPositions() {
 
 func (b *broker) closeAllOpenPositions() {
 	for pos := range b.openPositions {
-		b.closePosition(pos)
+		b.closePosition(pos, CloseTriggerEndOfTest)
 
 		log.Debug("📉 Position closed (end of test) at %s: Direction=%s, Quantity=%d, OpenPrice=%.5f, ClosePrice=%.5f",
 			b.currentTick().Timestamp.Format("2006-01-02 15:04:05"),
@@ -316,12 +387,13 @@ func (b *broker) closeAllOpenPositions() {
 	}
 }
 
-func (b *broker) closePosition(pos *position) {
-	pos.closePosition(b.currentTick())
+func (b *broker) closePosition(pos *position, trigger CloseTrigger) {
+	pos.closePosition(b.currentTick(), trigger, b.config)
 	delete(b.openPositions, pos)
 
 	b.capital += pos.getMargin(b.GetLeverage())
 	b.capital += pos.getProfitAndLoss()
+	b.abort.recordClose(pos.getProfitAndLoss())
 }
 
 func (b *broker) printSummary() {
@@ -384,14 +456,14 @@ func (b *broker) computeMetrics() map[common.Month]*Metrics {
 	// Compute metrics for each month
 	metrics := make(map[common.Month]*Metrics)
 	for month, positions := range positionsByMonth {
-		monthlyMetrics := b.computeMonthlyMetrics(positions)
+		monthlyMetrics := b.computePositionsMetrics(positions)
 		metrics[month] = monthlyMetrics
 	}
 
 	return metrics
 }
 
-func (b *broker) computeMonthlyMetrics(positions []*position) *Metrics {
+func (b *broker) computePositionsMetrics(positions []*position) *Metrics {
 	var totalTrades, winningTrades, longTrades, shortTrades int
 	var netPnL, grossProfit, grossLoss, totalR, maxR float64
 	var totalDuration time.Duration
@@ -399,6 +471,8 @@ func (b *broker) computeMonthlyMetrics(positions []*position) *Metrics {
 	equity := 0.0
 	peakEquity := 0.0
 	maxDrawdown := 0.0
+	highWater := 0.0 // Unlike peakEquity, includes the initial capital
+	maxAbsoluteDrawdown := 0.0
 
 	metrics := &Metrics{}
 
@@ -430,6 +504,8 @@ func (b *broker) computeMonthlyMetrics(positions []*position) *Metrics {
 		if drawdown > maxDrawdown {
 			maxDrawdown = drawdown
 		}
+		highWater = math.Max(highWater, equity)
+		maxAbsoluteDrawdown = math.Max(maxAbsoluteDrawdown, highWater-equity)
 
 		// R-multiple
 		risk := math.Abs(pos.openPrice - pos.stopLoss)
@@ -456,6 +532,7 @@ func (b *broker) computeMonthlyMetrics(positions []*position) *Metrics {
 
 	metrics.TotalTrades = totalTrades
 	metrics.NetPnL = netPnL
+	metrics.MaxDrawdown = maxAbsoluteDrawdown
 	metrics.LongTrades = longTrades
 	metrics.ShortTrades = shortTrades
 
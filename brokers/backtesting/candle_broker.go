@@ -0,0 +1,249 @@
+package backtesting
+
+import (
+	"fmt"
+	"go-experiments/brokers"
+	"time"
+)
+
+type IntrabarResolution int
+
+const (
+	// IntrabarWorstCase assumes the stop loss was hit first.
+	IntrabarWorstCase IntrabarResolution = iota
+
+	// IntrabarOHLCPath assumes the price moved open → low → high → close on bullish candles,
+	// and open → high → low → close on bearish candles.
+	IntrabarOHLCPath
+
+	// IntrabarTickDrilldown replays the ticks of the candle.
+	// Tick data is only loaded when a candle touches both levels.
+	IntrabarTickDrilldown
+)
+
+func (r IntrabarResolution) String() string {
+	switch r {
+	case IntrabarWorstCase:
+		return "worst-case"
+	case IntrabarOHLCPath:
+		return "ohlc-path"
+	case IntrabarTickDrilldown:
+		return "tick-drilldown"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseIntrabarResolution(s string) (IntrabarResolution, error) {
+	for _, r := range []IntrabarResolution{IntrabarWorstCase, IntrabarOHLCPath, IntrabarTickDrilldown} {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+
+	return IntrabarWorstCase, fmt.Errorf("unknown intrabar resolution: %s", s)
+}
+
+func (b *broker) runCandles() error {
+	candles := b.candles.candles
+	log.Debug("🚀 Starting candle backtest with %d candles and initial capital %.2f", len(candles), b.capital)
+
+	// Candles being built for timeframes larger than 1 minute
+	pending := make(map[brokers.Timeframe]*brokers.Candle)
+
+	for i := range candles {
+		current := &candles[i]
+
+		if current.IsGap {
+			b.current = openQuote(current)
+			b.cancelAllOpenPositions()
+		}
+
+		for pos := range b.openPositions {
+			b.resolveCandle(pos, current)
+		}
+
+		b.current = closeQuote(current)
+
+		var next *candle
+		if i+1 < len(candles) {
+			next = &candles[i+1]
+		}
+
+		b.processCandle(current, next, pending)
+
+		if err := b.checkAbort(); err != nil {
+			return err
+		}
+	}
+
+	b.closeAllOpenPositions()
+
+	log.Debug("✅ Backtest completed.")
+
+	return nil
+}
+
+func (b *broker) processCandle(current, next *candle, pending map[brokers.Timeframe]*brokers.Candle) {
+	for timeframe, callbacks := range b.callbacks {
+		bucket := current.Timestamp.Truncate(time.Duration(timeframe))
+		pending[timeframe] = mergeCandle(pending[timeframe], current)
+
+		// Is the next candle still in the same timeframe?
+		if next != nil && next.Timestamp.Truncate(time.Duration(timeframe)) == bucket {
+			continue
+		}
+
+		candle := *pending[timeframe]
+		delete(pending, timeframe)
+
+		for _, callback := range callbacks {
+			callback(candle)
+		}
+	}
+}
+
+func mergeCandle(pending *brokers.Candle, c *candle) *brokers.Candle {
+	if pending == nil {
+		return &brokers.Candle{
+			Open:   c.midOpen(),
+			Close:  c.midClose(),
+			High:   c.MidHigh,
+			Low:    c.MidLow,
+			Usable: !c.IsGap,
+		}
+	}
+
+	pending.Close = c.midClose()
+	pending.High = max(pending.High, c.MidHigh)
+	pending.Low = min(pending.Low, c.MidLow)
+	pending.Usable = pending.Usable && !c.IsGap
+
+	return pending
+}
+
+// resolveCandle closes the position if its stop loss or take profit is touched within the candle.
+func (b *broker) resolveCandle(pos *position, c *candle) {
+	var stopLossHit, takeProfitHit bool
+
+	switch pos.direction {
+	case brokers.PositionDirectionLong:
+		// Long positions are closed at the bid price
+		stopLossHit = c.BidLow <= pos.stopLoss
+		takeProfitHit = c.BidHigh >= pos.takeProfit
+	case brokers.PositionDirectionShort:
+		// Short positions are closed at the ask price
+		stopLossHit = c.AskHigh >= pos.stopLoss
+		takeProfitHit = c.AskLow <= pos.takeProfit
+	default:
+		panic("invalid position direction: " + pos.direction.String())
+	}
+
+	var trigger CloseTrigger
+	var fill *tick
+
+	switch {
+	case stopLossHit && takeProfitHit:
+		trigger, fill = b.resolveAmbiguousCandle(pos, c)
+	case stopLossHit:
+		trigger, fill = CloseTriggerStopLoss, levelFill(pos, c, CloseTriggerStopLoss)
+	case takeProfitHit:
+		trigger, fill = CloseTriggerTakeProfit, levelFill(pos, c, CloseTriggerTakeProfit)
+	default:
+		return
+	}
+
+	b.current = fill
+	b.closePosition(pos, trigger)
+
+	log.Debug("📉 Position closed (%s) at %s: Direction=%s, Quantity=%d, OpenPrice=%.5f, ClosePrice=%.5f",
+		trigger,
+		fill.Timestamp.Format("2006-01-02 15:04:05"),
+		pos.direction, pos.quantity, pos.openPrice, pos.closePrice)
+}
+
+// resolveAmbiguousCandle decides which level was hit first when a candle touches both.
+func (b *broker) resolveAmbiguousCandle(pos *position, c *candle) (CloseTrigger, *tick) {
+	worstCase := func() (CloseTrigger, *tick) {
+		return CloseTriggerStopLoss, levelFill(pos, c, CloseTriggerStopLoss)
+	}
+
+	switch b.config.Intrabar {
+	case IntrabarWorstCase:
+		return worstCase()
+
+	case IntrabarOHLCPath:
+		// The candle may open beyond one of the levels
+		if trigger := pos.isTriggered(openQuote(c)); trigger != CloseTriggerNone {
+			return trigger, levelFill(pos, c, trigger)
+		}
+
+		lowFirst := c.midClose() >= c.midOpen()
+		stopLossFirst := lowFirst == (pos.direction == brokers.PositionDirectionLong)
+		if stopLossFirst {
+			return CloseTriggerStopLoss, levelFill(pos, c, CloseTriggerStopLoss)
+		}
+		return CloseTriggerTakeProfit, levelFill(pos, c, CloseTriggerTakeProfit)
+
+	case IntrabarTickDrilldown:
+		ticks, err := b.candles.ticksOf(c.Timestamp)
+		if err != nil {
+			log.Warning("Cannot drill down into ticks at %s, assuming worst case: %v", c.Timestamp.Format("2006-01-02 15:04"), err)
+			return worstCase()
+		}
+
+		for i := range ticks {
+			if trigger := pos.isTriggered(&ticks[i]); trigger != CloseTriggerNone {
+				return trigger, &ticks[i]
+			}
+		}
+
+		log.Warning("Ticks at %s do not match candle, assuming worst case", c.Timestamp.Format("2006-01-02 15:04"))
+		return worstCase()
+
+	default:
+		panic("invalid intrabar resolution: " + b.config.Intrabar.String())
+	}
+}
+
+// levelFill returns the quote at which a level is filled: the level itself, or the open if the candle opens beyond it.
+func levelFill(pos *position, c *candle, trigger CloseTrigger) *tick {
+	var price float64
+
+	switch {
+	case pos.direction == brokers.PositionDirectionLong && trigger == CloseTriggerStopLoss:
+		price = min(pos.stopLoss, c.BidOpen)
+	case pos.direction == brokers.PositionDirectionLong && trigger == CloseTriggerTakeProfit:
+		price = max(pos.takeProfit, c.BidOpen)
+	case pos.direction == brokers.PositionDirectionShort && trigger == CloseTriggerStopLoss:
+		price = max(pos.stopLoss, c.AskOpen)
+	case pos.direction == brokers.PositionDirectionShort && trigger == CloseTriggerTakeProfit:
+		price = min(pos.takeProfit, c.AskOpen)
+	default:
+		panic("invalid fill")
+	}
+
+	return &tick{
+		Timestamp: c.FirstTick,
+		Bid:       price,
+		Ask:       price,
+	}
+}
+
+func openQuote(c *candle) *tick {
+	return &tick{
+		Timestamp: c.FirstTick,
+		Bid:       c.BidOpen,
+		Ask:       c.AskOpen,
+		IsGap:     c.IsGap,
+	}
+}
+
+func closeQuote(c *candle) *tick {
+	return &tick{
+		Timestamp: c.LastTick,
+		Bid:       c.BidClose,
+		Ask:       c.AskClose,
+		IsGap:     c.IsGap,
+	}
+}
@@ -0,0 +1,372 @@
+package backtesting
+
+import (
+	"fmt"
+	"go-experiments/common"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// CandleRow is one row of a M1 candle file, as written by the converter.
+// Bid and ask OHLC are stored separately so that stop loss and take profit can be resolved on the right side of the spread.
+type CandleRow struct {
+	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"` // Start of the minute
+	FirstTick int64   `parquet:"name=first_tick, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	LastTick  int64   `parquet:"name=last_tick, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	TickCount int64   `parquet:"name=tick_count, type=INT64"`
+	BidOpen   float64 `parquet:"name=bid_open, type=DOUBLE"`
+	BidHigh   float64 `parquet:"name=bid_high, type=DOUBLE"`
+	BidLow    float64 `parquet:"name=bid_low, type=DOUBLE"`
+	BidClose  float64 `parquet:"name=bid_close, type=DOUBLE"`
+	AskOpen   float64 `parquet:"name=ask_open, type=DOUBLE"`
+	AskHigh   float64 `parquet:"name=ask_high, type=DOUBLE"`
+	AskLow    float64 `parquet:"name=ask_low, type=DOUBLE"`
+	AskClose  float64 `parquet:"name=ask_close, type=DOUBLE"`
+	MidHigh   float64 `parquet:"name=mid_high, type=DOUBLE"` // Highest mid price, which is not the mid of bid and ask highs
+	MidLow    float64 `parquet:"name=mid_low, type=DOUBLE"`  // Lowest mid price
+}
+
+// CandleFileName returns the name of the M1 candle file of a month, next to the tick data file.
+func CandleFileName(symbol string, year int, month int) string {
+	return fmt.Sprintf("HISTDATA_COM_%s_M1%04d%02d.parquet", symbol, year, month)
+}
+
+// BuildCandleRows aggregates quotes into M1 candles. Quotes out of chronological order (e.g. raw ticks) are sorted
+// first, on a copy, so that each minute gets a single candle.
+func BuildCandleRows(quotes []Quote) []CandleRow {
+	byTime := func(a, b Quote) int { return a.Timestamp.Compare(b.Timestamp) }
+	if !slices.IsSortedFunc(quotes, byTime) {
+		quotes = slices.Clone(quotes)
+		slices.SortStableFunc(quotes, byTime)
+	}
+
+	rows := make([]CandleRow, 0)
+
+	var current *CandleRow
+	for i := range quotes {
+		q := &quotes[i]
+		bucket := q.Timestamp.Truncate(time.Minute).UnixMilli()
+		mid := q.mid()
+
+		if current == nil || current.Timestamp != bucket {
+			rows = append(rows, CandleRow{
+				Timestamp: bucket,
+				FirstTick: q.Timestamp.UnixMilli(),
+				BidOpen:   q.Bid,
+				BidHigh:   q.Bid,
+				BidLow:    q.Bid,
+				AskOpen:   q.Ask,
+				AskHigh:   q.Ask,
+				AskLow:    q.Ask,
+				MidHigh:   mid,
+				MidLow:    mid,
+			})
+			current = &rows[len(rows)-1]
+		}
+
+		current.LastTick = q.Timestamp.UnixMilli()
+		current.TickCount++
+		current.BidHigh = max(current.BidHigh, q.Bid)
+		current.BidLow = min(current.BidLow, q.Bid)
+		current.BidClose = q.Bid
+		current.AskHigh = max(current.AskHigh, q.Ask)
+		current.AskLow = min(current.AskLow, q.Ask)
+		current.AskClose = q.Ask
+		current.MidHigh = max(current.MidHigh, mid)
+		current.MidLow = min(current.MidLow, mid)
+	}
+
+	return rows
+}
+
+type candle struct {
+	Timestamp time.Time // Start of the minute
+	FirstTick time.Time
+	LastTick  time.Time
+	BidOpen   float64
+	BidHigh   float64
+	BidLow    float64
+	BidClose  float64
+	AskOpen   float64
+	AskHigh   float64
+	AskLow    float64
+	AskClose  float64
+	MidHigh   float64
+	MidLow    float64
+	IsGap     bool // Indicates if there is a gap in the data before or after this candle
+}
+
+func (c *candle) midOpen() float64 {
+	return (c.BidOpen + c.AskOpen) / 2
+}
+
+func (c *candle) midClose() float64 {
+	return (c.BidClose + c.AskClose) / 2
+}
+
+// CandleDataset holds precomputed M1 candles, to run backtests without replaying every tick.
+type CandleDataset struct {
+	candles   []candle
+	gaps      []Gap
+	symbol    string
+	beginDate time.Time
+	endDate   time.Time
+
+	// Tick data, lazily loaded when intrabar resolution needs it
+	ticks     map[common.Month]*Dataset
+	ticksLock sync.Mutex
+}
+
+func (d *CandleDataset) Symbol() string {
+	return d.symbol
+}
+
+func (d *CandleDataset) BeginDate() time.Time {
+	return d.beginDate
+}
+
+func (d *CandleDataset) EndDate() time.Time {
+	return d.endDate
+}
+
+func (d *CandleDataset) CandleCount() int {
+	return len(d.candles)
+}
+
+// Gaps returns the periods without data, classified as expected closures or outages.
+func (d *CandleDataset) Gaps() []Gap {
+	return d.gaps
+}
+
+func LoadCandleDataset(begin, end common.Month, symbol string) (*CandleDataset, error) {
+	beginTime := time.Now()
+
+	beginDate := begin.FirstDay()
+	endDate := end.LastDay()
+	candles := make([]candle, 0)
+
+	for d := beginDate; d.Before(endDate); d = d.AddDate(0, 1, 0) {
+		parquetFile := path.Join(dataPath, CandleFileName(symbol, d.Year(), int(d.Month())))
+
+		f, err := openParquetFile(parquetFile, new(CandleRow))
+		if err != nil {
+			return nil, fmt.Errorf("%w (run the converter to generate candle files)", err)
+		}
+
+		rows := make([]CandleRow, f.TickCount())
+		err = f.reader.Read(&rows)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Parquet rows: %v", err)
+		}
+
+		for _, r := range rows {
+			candles = append(candles, candleFromRow(&r))
+		}
+	}
+
+	// Mark gaps in the data
+	gaps := markCandleGaps(candles)
+
+	log.Debug("⏱️  Read %d candles in %s.", len(candles), time.Since(beginTime))
+	log.Info("📈 Loaded candle dataset from %s to %s", begin.String(), end.String())
+
+	dataset := &CandleDataset{
+		candles:   candles,
+		gaps:      gaps,
+		symbol:    symbol,
+		beginDate: beginDate,
+		endDate:   endDate,
+		ticks:     make(map[common.Month]*Dataset),
+	}
+
+	return dataset, nil
+}
+
+// NewCandleDataset builds the M1 candles of a tick dataset, e.g. a synthetic one without candle files. Its ticks are
+// kept for intrabar drill down.
+func NewCandleDataset(dataset *Dataset) *CandleDataset {
+	quotes := make([]Quote, len(dataset.ticks))
+	for i, t := range dataset.ticks {
+		quotes[i] = Quote{Timestamp: t.Timestamp, Bid: t.Bid, Ask: t.Ask}
+	}
+
+	rows := BuildCandleRows(quotes)
+	candles := make([]candle, len(rows))
+	for i := range rows {
+		candles[i] = candleFromRow(&rows[i])
+	}
+
+	ticks := make(map[common.Month]*Dataset)
+	for month := common.FromDate(dataset.beginDate); !month.FirstDay().After(dataset.endDate); month = month.AddMonths(1) {
+		ticks[month] = dataset
+	}
+
+	return &CandleDataset{
+		candles:   candles,
+		gaps:      markCandleGaps(candles),
+		symbol:    dataset.symbol,
+		beginDate: dataset.beginDate,
+		endDate:   dataset.endDate,
+		ticks:     ticks,
+	}
+}
+
+// MergeCandleDatasets concatenates chronologically ordered candle datasets of the same symbol, e.g. consecutive months.
+func MergeCandleDatasets(datasets ...*CandleDataset) (*CandleDataset, error) {
+	if len(datasets) == 0 {
+		return nil, fmt.Errorf("no candle dataset to merge")
+	}
+	if len(datasets) == 1 {
+		return datasets[0], nil
+	}
+
+	candleCount := 0
+	for _, d := range datasets {
+		if d.symbol != datasets[0].symbol {
+			return nil, fmt.Errorf("cannot merge candle datasets of different symbols: %s and %s", datasets[0].symbol, d.symbol)
+		}
+		candleCount += len(d.candles)
+	}
+
+	candles := make([]candle, 0, candleCount)
+	ticks := make(map[common.Month]*Dataset)
+	for _, d := range datasets {
+		candles = append(candles, d.candles...)
+		for month, dataset := range d.loadedTicks() {
+			ticks[month] = dataset
+		}
+	}
+
+	// Gaps are marked again to catch those at boundaries
+	first := datasets[0]
+	last := datasets[len(datasets)-1]
+	return &CandleDataset{
+		candles:   candles,
+		gaps:      markCandleGaps(candles),
+		symbol:    first.symbol,
+		beginDate: first.beginDate,
+		endDate:   last.endDate,
+		ticks:     ticks,
+	}, nil
+}
+
+// Slice returns the candles starting within the time range.
+// Candles are shared with the original dataset.
+func (d *CandleDataset) Slice(timeRange common.TimeRange) *CandleDataset {
+	first := sort.Search(len(d.candles), func(i int) bool { return !d.candles[i].Timestamp.Before(timeRange.Begin()) })
+	last := sort.Search(len(d.candles), func(i int) bool { return !d.candles[i].Timestamp.Before(timeRange.End()) })
+
+	gaps := make([]Gap, 0)
+	for _, gap := range d.gaps {
+		if timeRange.Contains(gap.Begin) && timeRange.Contains(gap.End) {
+			gaps = append(gaps, gap)
+		}
+	}
+
+	return &CandleDataset{
+		candles:   d.candles[first:last],
+		gaps:      gaps,
+		symbol:    d.symbol,
+		beginDate: timeRange.Begin(),
+		endDate:   timeRange.End(),
+		ticks:     d.loadedTicks(),
+	}
+}
+
+// MemorySize estimates the memory used by the candles, in bytes, leaving out tick data.
+// Sliced datasets share candles, so their sizes must not be summed with the original one.
+func (d *CandleDataset) MemorySize() int64 {
+	return int64(cap(d.candles))*int64(unsafe.Sizeof(candle{})) + int64(cap(d.gaps))*int64(unsafe.Sizeof(Gap{}))
+}
+
+// loadedTicks returns a copy of the tick data loaded so far.
+func (d *CandleDataset) loadedTicks() map[common.Month]*Dataset {
+	d.ticksLock.Lock()
+	defer d.ticksLock.Unlock()
+
+	return maps.Clone(d.ticks)
+}
+
+func candleFromRow(r *CandleRow) candle {
+	return candle{
+		Timestamp: time.UnixMilli(r.Timestamp),
+		FirstTick: time.UnixMilli(r.FirstTick),
+		LastTick:  time.UnixMilli(r.LastTick),
+		BidOpen:   r.BidOpen,
+		BidHigh:   r.BidHigh,
+		BidLow:    r.BidLow,
+		BidClose:  r.BidClose,
+		AskOpen:   r.AskOpen,
+		AskHigh:   r.AskHigh,
+		AskLow:    r.AskLow,
+		AskClose:  r.AskClose,
+		MidHigh:   r.MidHigh,
+		MidLow:    r.MidLow,
+	}
+}
+
+// CandleFileChecksum hashes the candle file of the month as stored, like TickFileChecksum.
+func CandleFileChecksum(symbol string, month common.Month) (string, error) {
+	return fileChecksum(path.Join(dataPath, CandleFileName(symbol, month.Year(), month.Month())))
+}
+
+// markCandleGaps applies the same rules as markGaps, between the last tick of a candle and the first tick of the next one.
+func markCandleGaps(candles []candle) []Gap {
+	gaps := make([]Gap, 0)
+
+	for i := 1; i < len(candles); i++ {
+		previous := &candles[i-1]
+		current := &candles[i]
+
+		if current.FirstTick.Sub(previous.LastTick) <= MaxGap {
+			continue
+		}
+
+		kind := classifyGap(previous.LastTick, current.FirstTick)
+		if kind == GapKindNone {
+			continue
+		}
+
+		previous.IsGap = true
+		current.IsGap = true
+
+		gaps = append(gaps, Gap{
+			Begin: previous.LastTick,
+			End:   current.FirstTick,
+			Kind:  kind,
+		})
+	}
+
+	return gaps
+}
+
+// ticksOf returns the ticks of the minute starting at the given time, loading the tick data of the month if needed.
+func (d *CandleDataset) ticksOf(minute time.Time) ([]tick, error) {
+	month := common.FromDate(minute)
+
+	d.ticksLock.Lock()
+	dataset, ok := d.ticks[month]
+	if !ok {
+		var err error
+		dataset, err = LoadDataset(month, month, d.symbol)
+		if err != nil {
+			d.ticksLock.Unlock()
+			return nil, err
+		}
+		d.ticks[month] = dataset
+	}
+	d.ticksLock.Unlock()
+
+	end := minute.Add(time.Minute)
+	ticks := dataset.ticks
+	first := sort.Search(len(ticks), func(i int) bool { return !ticks[i].Timestamp.Before(minute) })
+	last := sort.Search(len(ticks), func(i int) bool { return !ticks[i].Timestamp.Before(end) })
+
+	return ticks[first:last], nil
+}
@@ -0,0 +1,210 @@
+package backtesting
+
+import (
+	"cmp"
+	"fmt"
+	"go-experiments/common"
+	"math"
+	"slices"
+	"time"
+)
+
+// Quote is a raw bid/ask quote, as read from the source files.
+type Quote struct {
+	Timestamp time.Time
+	Bid       float64
+	Ask       float64
+}
+
+func (q *Quote) mid() float64 {
+	return (q.Bid + q.Ask) / 2
+}
+
+type CleaningConfig struct {
+	DropZeroPrices          bool    // Remove quotes with a zero or negative bid or ask
+	DropCrossedQuotes       bool    // Remove quotes where ask < bid
+	SortOutOfOrder          bool    // Reorder quotes that are not in chronological order
+	DropDuplicateTimestamps bool    // Keep only the last quote of a given timestamp
+	SpikeThreshold          float64 // Relative mid price move for a single quote to be considered as a spike (0 to disable)
+}
+
+// DefaultCleaningConfig enables all filters, with a spike threshold of 0.2% (~20 pips on EUR/USD).
+func DefaultCleaningConfig() *CleaningConfig {
+	return &CleaningConfig{
+		DropZeroPrices:          true,
+		DropCrossedQuotes:       true,
+		SortOutOfOrder:          true,
+		DropDuplicateTimestamps: true,
+		SpikeThreshold:          0.002,
+	}
+}
+
+// CleaningStats holds what was removed or corrected in a month of quotes.
+type CleaningStats struct {
+	TotalQuotes         int // Number of quotes before cleaning
+	ZeroPrices          int // Removed
+	CrossedQuotes       int // Removed
+	DuplicateTimestamps int // Removed
+	Spikes              int // Removed
+	OutOfOrder          int // Corrected
+}
+
+func (s *CleaningStats) Removed() int {
+	return s.ZeroPrices + s.CrossedQuotes + s.DuplicateTimestamps + s.Spikes
+}
+
+func (s *CleaningStats) Corrected() int {
+	return s.OutOfOrder
+}
+
+func (s *CleaningStats) String() string {
+	return fmt.Sprintf("total=%d, removed=%d (zero=%d, crossed=%d, duplicates=%d, spikes=%d), corrected=%d (out of order=%d)",
+		s.TotalQuotes, s.Removed(), s.ZeroPrices, s.CrossedQuotes, s.DuplicateTimestamps, s.Spikes,
+		s.Corrected(), s.OutOfOrder)
+}
+
+// CleaningReport holds cleaning statistics per month.
+type CleaningReport map[common.Month]*CleaningStats
+
+// Months returns the months of the report in chronological order.
+func (r CleaningReport) Months() []common.Month {
+	months := make([]common.Month, 0, len(r))
+	for month := range r {
+		months = append(months, month)
+	}
+
+	slices.SortFunc(months, func(a, b common.Month) int {
+		return cmp.Or(cmp.Compare(a.Year(), b.Year()), cmp.Compare(a.Month(), b.Month()))
+	})
+
+	return months
+}
+
+func (r CleaningReport) stats(timestamp time.Time) *CleaningStats {
+	month := common.FromDate(timestamp)
+	stats, ok := r[month]
+	if !ok {
+		stats = &CleaningStats{}
+		r[month] = stats
+	}
+	return stats
+}
+
+// merge adds the statistics of the other report, files spilling over the same month being summed.
+func (r CleaningReport) merge(other CleaningReport) {
+	for month, stats := range other {
+		existing, ok := r[month]
+		if !ok {
+			r[month] = stats
+			continue
+		}
+
+		existing.TotalQuotes += stats.TotalQuotes
+		existing.ZeroPrices += stats.ZeroPrices
+		existing.CrossedQuotes += stats.CrossedQuotes
+		existing.DuplicateTimestamps += stats.DuplicateTimestamps
+		existing.Spikes += stats.Spikes
+		existing.OutOfOrder += stats.OutOfOrder
+	}
+}
+
+// CleanQuotes applies the configured filters on the quotes.
+// The input slice is reused, and the returned slice must be used instead.
+func CleanQuotes(quotes []Quote, config *CleaningConfig) ([]Quote, CleaningReport) {
+	report := make(CleaningReport)
+
+	for i := range quotes {
+		report.stats(quotes[i].Timestamp).TotalQuotes++
+	}
+
+	// Invalid prices
+	quotes = slices.DeleteFunc(quotes, func(q Quote) bool {
+		if config.DropZeroPrices && (q.Bid <= 0 || q.Ask <= 0) {
+			report.stats(q.Timestamp).ZeroPrices++
+			return true
+		}
+		if config.DropCrossedQuotes && q.Ask < q.Bid {
+			report.stats(q.Timestamp).CrossedQuotes++
+			return true
+		}
+		return false
+	})
+
+	// Ordering
+	if config.SortOutOfOrder {
+		var latest time.Time
+		unordered := false
+		for i := range quotes {
+			if quotes[i].Timestamp.Before(latest) {
+				report.stats(quotes[i].Timestamp).OutOfOrder++
+				unordered = true
+			} else {
+				latest = quotes[i].Timestamp
+			}
+		}
+
+		if unordered {
+			slices.SortStableFunc(quotes, func(a, b Quote) int {
+				return a.Timestamp.Compare(b.Timestamp)
+			})
+		}
+	}
+
+	// Duplicates: keep the last quote of each timestamp
+	if config.DropDuplicateTimestamps {
+		quotes = dropDuplicateTimestamps(quotes, report)
+	}
+
+	// Single quote spikes
+	if config.SpikeThreshold > 0 {
+		quotes = dropSpikes(quotes, config.SpikeThreshold, report)
+	}
+
+	return quotes, report
+}
+
+func dropDuplicateTimestamps(quotes []Quote, report CleaningReport) []Quote {
+	result := quotes[:0]
+
+	for i := range quotes {
+		if i+1 < len(quotes) && quotes[i+1].Timestamp.Equal(quotes[i].Timestamp) {
+			report.stats(quotes[i].Timestamp).DuplicateTimestamps++
+			continue
+		}
+		result = append(result, quotes[i])
+	}
+
+	return result
+}
+
+// dropSpikes removes quotes which jump away from both neighbours, while the neighbours agree with each other.
+func dropSpikes(quotes []Quote, threshold float64, report CleaningReport) []Quote {
+	if len(quotes) < 3 {
+		return quotes
+	}
+
+	spikes := make([]bool, len(quotes))
+	for i := 1; i < len(quotes)-1; i++ {
+		previous := quotes[i-1].mid()
+		current := quotes[i].mid()
+		next := quotes[i+1].mid()
+
+		moveIn := (current - previous) / previous
+		moveOut := (current - next) / next
+		neighbours := math.Abs(next-previous) / previous
+
+		if math.Abs(moveIn) > threshold && math.Abs(moveOut) > threshold && neighbours <= threshold && (moveIn > 0) == (moveOut > 0) {
+			spikes[i] = true
+			report.stats(quotes[i].Timestamp).Spikes++
+		}
+	}
+
+	result := quotes[:0]
+	for i := range quotes {
+		if !spikes[i] {
+			result = append(result, quotes[i])
+		}
+	}
+
+	return result
+}
@@ -1,11 +1,19 @@
 package backtesting
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"go-experiments/common"
+	"io"
+	"math"
+	"os"
 	"path"
 	"runtime"
+	"sort"
+	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/xitongsys/parquet-go-source/local"
 	"github.com/xitongsys/parquet-go/reader"
@@ -14,15 +22,18 @@ import (
 
 const dataPath = "brokers/backtesting/data"
 
-const MaxGap = time.Minute // Maximum allowed gap between ticks
-
 // https://www.histdata.com/download-free-forex-historical-data/?/ascii/tick-data-quotes/EURUSD
 
 type Dataset struct {
 	ticks     []tick
+	gaps      []Gap
+	cleaning  CleaningReport
 	symbol    string
 	beginDate time.Time
 	endDate   time.Time
+
+	checksum     string
+	checksumOnce sync.Once
 }
 
 func (d *Dataset) Symbol() string {
@@ -41,6 +52,39 @@ func (d *Dataset) TickCount() int {
 	return len(d.ticks)
 }
 
+// MemorySize estimates the memory used by the dataset, in bytes.
+// Sliced datasets share ticks, so their sizes must not be summed with the original one.
+func (d *Dataset) MemorySize() int64 {
+	return int64(cap(d.ticks))*int64(unsafe.Sizeof(tick{})) + int64(cap(d.gaps))*int64(unsafe.Sizeof(Gap{}))
+}
+
+// Gaps returns the periods without data, classified as expected closures or outages.
+func (d *Dataset) Gaps() []Gap {
+	return d.gaps
+}
+
+// CleaningReport returns what was removed or corrected while loading, nil if the dataset was not cleaned.
+func (d *Dataset) CleaningReport() CleaningReport {
+	return d.cleaning
+}
+
+// Checksum identifies the content of the dataset, so that results can be tied to the data they were computed on.
+// It is computed on first call.
+func (d *Dataset) Checksum() string {
+	d.checksumOnce.Do(func() {
+		hash := sha256.New()
+		buf := make([]byte, 24)
+		for _, t := range d.ticks {
+			binary.LittleEndian.PutUint64(buf[0:], uint64(t.Timestamp.UnixNano()))
+			binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(t.Bid))
+			binary.LittleEndian.PutUint64(buf[16:], math.Float64bits(t.Ask))
+			hash.Write(buf)
+		}
+		d.checksum = fmt.Sprintf("%x", hash.Sum(nil))
+	})
+	return d.checksum
+}
+
 func (d *Dataset) Ticks() func(yield func(Tick) bool) {
 	return func(yield func(Tick) bool) {
 		for _, tick := range d.ticks {
@@ -51,7 +95,16 @@ func (d *Dataset) Ticks() func(yield func(Tick) bool) {
 	}
 }
 
+type LoadOptions struct {
+	// Cleaning filters to apply on raw quotes, nil to load them as is.
+	Cleaning *CleaningConfig
+}
+
 func LoadDataset(begin, end common.Month, symbol string) (*Dataset, error) {
+	return LoadDatasetWithOptions(begin, end, symbol, &LoadOptions{})
+}
+
+func LoadDatasetWithOptions(begin, end common.Month, symbol string, options *LoadOptions) (*Dataset, error) {
 	beginTime := time.Now()
 
 	files := make([]*file, 0) // Preallocate for 12 months
@@ -73,43 +126,111 @@ func LoadDataset(begin, end common.Month, symbol string) (*Dataset, error) {
 		tickCount += f.TickCount()
 	}
 
-	ticks := make([]tick, tickCount)
-	offset := 0
+	var report CleaningReport
+	if options.Cleaning != nil {
+		report = make(CleaningReport)
+	}
+
+	ticks := make([]tick, 0, tickCount)
 	for _, f := range files {
-		if err := f.ReadTicks(ticks, offset); err != nil {
+		quotes, err := f.ReadQuotes()
+		if err != nil {
 			return nil, fmt.Errorf("failed to read ticks from file: %v", err)
 		}
-		offset += f.TickCount()
+
+		if options.Cleaning != nil {
+			var fileReport CleaningReport
+			quotes, fileReport = CleanQuotes(quotes, options.Cleaning)
+			report.merge(fileReport)
+		}
+
+		for _, q := range quotes {
+			ticks = append(ticks, tick{
+				Timestamp: q.Timestamp,
+				Bid:       q.Bid,
+				Ask:       q.Ask,
+				IsGap:     false, // Default to false, will be updated later
+			})
+		}
 	}
 
-	// Mark gaps in the data
-	markGaps(ticks)
+	for _, month := range report.Months() {
+		log.Info("🧹 Cleaned %s: %s", month.String(), report[month].String())
+	}
+
+	dataset := newDataset(symbol, beginDate, endDate, ticks)
+	dataset.cleaning = report
 
 	endTime := time.Now()
 	duration := endTime.Sub(beginTime)
 	log.Debug("⏱️  Read %d ticks from %d file(s) in %s.", tickCount, len(files), duration)
 	log.Info("📈 Loaded dataset from %s to %s", begin.String(), end.String())
 
-	dataset := &Dataset{
+	return dataset, nil
+}
+
+func newDataset(symbol string, beginDate, endDate time.Time, ticks []tick) *Dataset {
+	// Mark gaps in the data
+	gaps := markGaps(ticks)
+
+	return &Dataset{
 		ticks:     ticks,
+		gaps:      gaps,
 		symbol:    symbol,
 		beginDate: beginDate,
 		endDate:   endDate,
 	}
+}
 
-	return dataset, nil
+// MergeDatasets concatenates chronologically ordered datasets of the same symbol, e.g. consecutive months.
+func MergeDatasets(datasets ...*Dataset) (*Dataset, error) {
+	if len(datasets) == 0 {
+		return nil, fmt.Errorf("no dataset to merge")
+	}
+	if len(datasets) == 1 {
+		return datasets[0], nil
+	}
+
+	tickCount := 0
+	for _, d := range datasets {
+		if d.symbol != datasets[0].symbol {
+			return nil, fmt.Errorf("cannot merge datasets of different symbols: %s and %s", datasets[0].symbol, d.symbol)
+		}
+		tickCount += len(d.ticks)
+	}
+
+	ticks := make([]tick, 0, tickCount)
+	for _, d := range datasets {
+		ticks = append(ticks, d.ticks...)
+	}
+
+	// Gaps are marked again to catch those at boundaries
+	first := datasets[0]
+	last := datasets[len(datasets)-1]
+	return newDataset(first.symbol, first.beginDate, last.endDate, ticks), nil
 }
 
-func markGaps(ticks []tick) {
-	for i := 1; i < len(ticks)-1; i++ {
-		previous := &ticks[i-1]
-		current := &ticks[i]
+// Slice returns the part of the dataset within the time range.
+// Ticks are shared with the original dataset.
+func (d *Dataset) Slice(timeRange common.TimeRange) *Dataset {
+	first := sort.Search(len(d.ticks), func(i int) bool { return !d.ticks[i].Timestamp.Before(timeRange.Begin()) })
+	last := sort.Search(len(d.ticks), func(i int) bool { return !d.ticks[i].Timestamp.Before(timeRange.End()) })
 
-		if current.Timestamp.Sub(previous.Timestamp) > MaxGap {
-			current.IsGap = true
-			previous.IsGap = true
+	gaps := make([]Gap, 0)
+	for _, gap := range d.gaps {
+		if timeRange.Contains(gap.Begin) && timeRange.Contains(gap.End) {
+			gaps = append(gaps, gap)
 		}
 	}
+
+	return &Dataset{
+		ticks:     d.ticks[first:last],
+		gaps:      gaps,
+		cleaning:  d.cleaning,
+		symbol:    d.symbol,
+		beginDate: timeRange.Begin(),
+		endDate:   timeRange.End(),
+	}
 }
 
 type Tick interface {
@@ -117,6 +238,7 @@ type Tick interface {
 	GetBid() float64
 	GetAsk() float64
 	GetIsGap() bool
+	GetGapKind() GapKind
 }
 
 // Tick represents one row of tick data
@@ -124,7 +246,8 @@ type tick struct {
 	Timestamp time.Time
 	Bid       float64
 	Ask       float64
-	IsGap     bool // Indicates if there is a gap in the data before or after this tick
+	IsGap     bool    // Indicates if there is a gap in the data before or after this tick
+	GapKind   GapKind // Kind of the gap if IsGap is set
 }
 
 func (t *tick) GetTimestamp() time.Time {
@@ -143,6 +266,19 @@ func (t *tick) GetIsGap() bool {
 	return t.IsGap
 }
 
+func (t *tick) GetGapKind() GapKind {
+	return t.GapKind
+}
+
+func (t *tick) markGap(kind GapKind) {
+	t.IsGap = true
+
+	// A tick can be surrounded by two gaps, keep the most severe one
+	if kind > t.GapKind {
+		t.GapKind = kind
+	}
+}
+
 // Use intermediate struct with int64 timestamp
 type parquetTick struct {
 	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
@@ -161,16 +297,54 @@ type file struct {
 	reader *reader.ParquetReader
 }
 
+// TickFileName returns the name of the tick data file of a month.
+func TickFileName(symbol string, year int, month int) string {
+	return fmt.Sprintf("HISTDATA_COM_%s_T%04d%02d.parquet", symbol, year, month)
+}
+
 func openFile(year int, month int, symbol string) (*file, error) {
-	parquetFile := path.Join(dataPath, fmt.Sprintf("HISTDATA_COM_%s_T%04d%02d.parquet", symbol, year, month))
+	parquetFile := path.Join(dataPath, TickFileName(symbol, year, month))
+	return openParquetFile(parquetFile, new(parquetTick))
+}
+
+// ReadTickFile reads the quotes of a tick data file as written, e.g. to build the candles of existing tick files.
+func ReadTickFile(parquetFile string) ([]Quote, error) {
+	f, err := openParquetFile(parquetFile, new(parquetTick))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.ReadQuotes()
+}
+
+// TickFileChecksum hashes the tick data file of the month as stored, identifying the data without decoding it.
+func TickFileChecksum(symbol string, month common.Month) (string, error) {
+	return fileChecksum(path.Join(dataPath, TickFileName(symbol, month.Year(), month.Month())))
+}
+
+func fileChecksum(parquetFile string) (string, error) {
+	f, err := os.Open(parquetFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open data file: %w", err)
+	}
+	defer f.Close()
 
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read data file '%s': %w", parquetFile, err)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func openParquetFile(parquetFile string, schema any) (*file, error) {
 	// Open Parquet file
 	pFile, err := local.NewLocalFileReader(parquetFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open Parquet file '%s': %v", parquetFile, err)
 	}
 
-	reader, err := reader.NewParquetReader(pFile, new(parquetTick), int64(runtime.NumCPU()))
+	reader, err := reader.NewParquetReader(pFile, schema, int64(runtime.NumCPU()))
 	if err != nil {
 		pFile.Close()
 		return nil, fmt.Errorf("failed to create Parquet reader for '%s': %v", parquetFile, err)
@@ -188,20 +362,21 @@ func (f *file) TickCount() int {
 	return int(f.reader.GetNumRows())
 }
 
-func (f *file) ReadTicks(array []tick, offset int) error {
+func (f *file) ReadQuotes() ([]Quote, error) {
 
 	rows := make([]parquetTick, f.TickCount())
 	if err := f.reader.Read(&rows); err != nil {
-		return fmt.Errorf("failed to read Parquet rows: %v", err)
+		return nil, fmt.Errorf("failed to read Parquet rows: %v", err)
 	}
+
+	quotes := make([]Quote, len(rows))
 	for i, r := range rows {
-		array[offset+i] = tick{
+		quotes[i] = Quote{
 			Timestamp: time.UnixMilli(r.Timestamp),
 			Bid:       r.Bid,
 			Ask:       r.Ask,
-			IsGap:     false, // Default to false, will be updated later
 		}
 	}
 
-	return nil
+	return quotes, nil
 }
@@ -0,0 +1,117 @@
+package backtesting
+
+import (
+	"go-experiments/common"
+	"time"
+)
+
+const MaxGap = time.Minute           // Maximum allowed gap between ticks during liquid hours (London or New York session)
+const MaxQuietGap = 15 * time.Minute // Maximum allowed gap between ticks during quiet hours (e.g. Asian session)
+
+type GapKind int
+
+const (
+	// GapKindNone means there is no gap around the tick.
+	GapKindNone GapKind = iota
+
+	// GapKindClosure means the silence is expected because the market is closed (weekend, holiday).
+	GapKindClosure
+
+	// GapKindOutage means the silence happened while the market was open, i.e. data is missing.
+	GapKindOutage
+)
+
+func (k GapKind) String() string {
+	switch k {
+	case GapKindNone:
+		return "none"
+	case GapKindClosure:
+		return "closure"
+	case GapKindOutage:
+		return "outage"
+	default:
+		return "unknown"
+	}
+}
+
+// Gap represents a period without ticks in the dataset.
+type Gap struct {
+	// Timestamp of the last tick before the gap
+	Begin time.Time
+
+	// Timestamp of the first tick after the gap
+	End time.Time
+
+	// Whether the gap is an expected closure or a data outage
+	Kind GapKind
+}
+
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Begin)
+}
+
+// markGaps flags ticks surrounding gaps, and returns the list of detected gaps.
+func markGaps(ticks []tick) []Gap {
+	gaps := make([]Gap, 0)
+
+	for i := 1; i < len(ticks); i++ {
+		previous := &ticks[i-1]
+		current := &ticks[i]
+
+		if current.Timestamp.Sub(previous.Timestamp) <= MaxGap {
+			continue
+		}
+
+		kind := classifyGap(previous.Timestamp, current.Timestamp)
+		if kind == GapKindNone {
+			continue
+		}
+
+		previous.markGap(kind)
+		current.markGap(kind)
+
+		gaps = append(gaps, Gap{
+			Begin: previous.Timestamp,
+			End:   current.Timestamp,
+			Kind:  kind,
+		})
+	}
+
+	return gaps
+}
+
+// classifyGap decides if a silence between two ticks is expected or not, using the FX market schedule.
+func classifyGap(begin, end time.Time) GapKind {
+	var openDuration time.Duration
+	closed := false
+
+	for t := begin; t.Before(end); t = t.Add(time.Minute) {
+		step := min(time.Minute, end.Sub(t))
+
+		if common.IsFXMarketOpen(t) {
+			openDuration += step
+		} else {
+			closed = true
+		}
+	}
+
+	if closed {
+		// Tolerate quiet minutes around the market open and close
+		if openDuration > MaxQuietGap {
+			return GapKindOutage
+		}
+
+		return GapKindClosure
+	}
+
+	threshold := MaxQuietGap
+	if common.LondonSession.IsOpen(begin) || common.NYSession.IsOpen(begin) {
+		threshold = MaxGap
+	}
+
+	if openDuration > threshold {
+		return GapKindOutage
+	}
+
+	return GapKindNone
+}
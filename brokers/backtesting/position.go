@@ -17,10 +17,14 @@ type position struct {
 	stopLoss   float64
 	takeProfit float64
 
+	// Trading costs
+	commission float64 // Commissions paid so far (open and close)
+
 	// Close position details
-	closePrice float64
-	closeTime  time.Time
-	closed     bool
+	closePrice   float64
+	closeTime    time.Time
+	closeTrigger CloseTrigger
+	closed       bool
 
 	// Backtesting specific
 	canceled bool
@@ -67,17 +71,19 @@ func (p *position) Canceled() bool {
 
 var _ brokers.Position = (*position)(nil)
 
-func newPosition(currentTick *tick, capital float64, order *brokers.Order) *position {
+func newPosition(currentTick *tick, capital float64, order *brokers.Order, config *Config) *position {
 
 	return &position{
 		direction: order.Direction,
 		quantity:  order.Quantity,
-		openPrice: getOpenPrice(order.Direction, currentTick),
+		openPrice: applySlippage(getOpenPrice(order.Direction, currentTick), order.Direction, true, config.Slippage),
 		openTime:  currentTick.Timestamp,
 		capital:   capital,
 
 		stopLoss:   order.StopLoss,
 		takeProfit: order.TakeProfit,
+
+		commission: config.Commission * float64(order.Quantity),
 	}
 }
 
@@ -87,8 +93,24 @@ const (
 	CloseTriggerNone CloseTrigger = iota
 	CloseTriggerStopLoss
 	CloseTriggerTakeProfit
+	CloseTriggerEndOfTest // Closed by the broker at the end of the backtest
 )
 
+func (t CloseTrigger) String() string {
+	switch t {
+	case CloseTriggerNone:
+		return "none"
+	case CloseTriggerStopLoss:
+		return "stop loss"
+	case CloseTriggerTakeProfit:
+		return "take profit"
+	case CloseTriggerEndOfTest:
+		return "end of test"
+	default:
+		return "unknown"
+	}
+}
+
 // isTriggered checks if the position should be closed based on the current tick.
 func (pos *position) isTriggered(currentTick *tick) CloseTrigger {
 	price := getClosePrice(pos.direction, currentTick)
@@ -122,9 +144,11 @@ func (pos *position) isTriggered(currentTick *tick) CloseTrigger {
 	}
 }
 
-func (pos *position) closePosition(currentTick *tick) {
-	pos.closePrice = getClosePrice(pos.direction, currentTick)
+func (pos *position) closePosition(currentTick *tick, trigger CloseTrigger, config *Config) {
+	pos.closePrice = applySlippage(getClosePrice(pos.direction, currentTick), pos.direction, false, config.Slippage)
+	pos.commission += config.Commission * float64(pos.quantity)
 	pos.closeTime = currentTick.Timestamp
+	pos.closeTrigger = trigger
 	pos.closed = true
 }
 
@@ -167,6 +191,15 @@ func getClosePrice(direction brokers.PositionDirection, currentTick *tick) float
 	}
 }
 
+// applySlippage moves the fill price against the position: buying higher, selling lower.
+func applySlippage(price float64, direction brokers.PositionDirection, opening bool, slippage float64) float64 {
+	buying := (direction == brokers.PositionDirectionLong) == opening
+	if buying {
+		return price + slippage
+	}
+	return price - slippage
+}
+
 func (pos *position) getMargin(leverage float64) float64 {
 	totalAmount := float64(pos.Quantity()) * pos.openPrice
 	margin := totalAmount / leverage
@@ -184,5 +217,5 @@ func (pos *position) getProfitAndLoss() float64 {
 		diff = -diff
 	}
 	totalAmount := float64(pos.Quantity()) * diff
-	return totalAmount
+	return totalAmount - pos.commission
 }
@@ -0,0 +1,173 @@
+package backtesting
+
+import (
+	"fmt"
+	"go-experiments/common"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// NewsSessions are the daily windows around major economic releases, where spreads usually widen.
+var NewsSessions = func() []*common.Session {
+	newYork, _ := time.LoadLocation("America/New_York")
+	london, _ := time.LoadLocation("Europe/London")
+	frankfurt, _ := time.LoadLocation("Europe/Berlin")
+
+	return []*common.Session{
+		common.NewSession("UK releases", 7, 0, 7, 10, london),
+		common.NewSession("ECB decision", 13, 45, 14, 45, frankfurt),
+		common.NewSession("US releases", 8, 30, 8, 45, newYork),
+		common.NewSession("US late releases", 10, 0, 10, 10, newYork),
+		common.NewSession("FOMC decision", 14, 0, 14, 30, newYork),
+	}
+}()
+
+type perturbationContext struct {
+	rng       *rand.Rand
+	reference float64 // Mid price of the first tick of the dataset
+}
+
+// Perturbation transforms quotes while replaying a dataset.
+type Perturbation struct {
+	name string
+
+	// Returns false to drop the quote
+	apply func(ctx *perturbationContext, q *Quote) bool
+}
+
+func (p Perturbation) String() string {
+	return p.name
+}
+
+// PriceNoise adds gaussian noise with the given standard deviation (in price units) to each quote, keeping the spread.
+func PriceNoise(stdDev float64) Perturbation {
+	return Perturbation{
+		name: fmt.Sprintf("PriceNoise(%.5f)", stdDev),
+		apply: func(ctx *perturbationContext, q *Quote) bool {
+			noise := ctx.rng.NormFloat64() * stdDev
+			q.Bid += noise
+			q.Ask += noise
+			return true
+		},
+	}
+}
+
+// WidenedSpread multiplies the spread of quotes within the given sessions, e.g. NewsSessions.
+func WidenedSpread(multiplier float64, sessions ...*common.Session) Perturbation {
+	names := make([]string, len(sessions))
+	for i, session := range sessions {
+		names[i] = session.String()
+	}
+
+	return Perturbation{
+		name: fmt.Sprintf("WidenedSpread(%.1f, %s)", multiplier, strings.Join(names, ", ")),
+		apply: func(ctx *perturbationContext, q *Quote) bool {
+			for _, session := range sessions {
+				if session.IsOpen(q.Timestamp) {
+					mid := q.mid()
+					halfSpread := (q.Ask - q.Bid) / 2 * multiplier
+					q.Bid = mid - halfSpread
+					q.Ask = mid + halfSpread
+					break
+				}
+			}
+			return true
+		},
+	}
+}
+
+// Dropout randomly removes quotes with the given probability.
+func Dropout(probability float64) Perturbation {
+	return Perturbation{
+		name: fmt.Sprintf("Dropout(%.2f%%)", probability*100),
+		apply: func(ctx *perturbationContext, q *Quote) bool {
+			return ctx.rng.Float64() >= probability
+		},
+	}
+}
+
+// TimeShift moves all quotes in time, so that market events do not happen at the same hour anymore.
+func TimeShift(shift time.Duration) Perturbation {
+	return Perturbation{
+		name: fmt.Sprintf("TimeShift(%s)", shift.String()),
+		apply: func(ctx *perturbationContext, q *Quote) bool {
+			q.Timestamp = q.Timestamp.Add(shift)
+			return true
+		},
+	}
+}
+
+// Invert mirrors prices around the first price of the dataset, so that uptrends become downtrends.
+// A strategy without directional bias should perform similarly on inverted data.
+func Invert() Perturbation {
+	return Perturbation{
+		name: "Invert",
+		apply: func(ctx *perturbationContext, q *Quote) bool {
+			bid := 2*ctx.reference - q.Ask
+			ask := 2*ctx.reference - q.Bid
+			q.Bid = bid
+			q.Ask = ask
+			return true
+		},
+	}
+}
+
+// Scenario is a set of perturbations applied on a replay of a dataset.
+type Scenario struct {
+	perturbations []Perturbation
+}
+
+func NewScenario(perturbations ...Perturbation) *Scenario {
+	return &Scenario{perturbations: perturbations}
+}
+
+func (s *Scenario) String() string {
+	names := make([]string, len(s.perturbations))
+	for i, p := range s.perturbations {
+		names[i] = p.String()
+	}
+	return fmt.Sprintf("Scenario(%s)", strings.Join(names, ", "))
+}
+
+// Apply replays the dataset through the perturbations, and returns the perturbed dataset.
+// Random perturbations are deterministic for a given seed.
+func (s *Scenario) Apply(dataset *Dataset, seed int64) *Dataset {
+	ctx := &perturbationContext{
+		rng: rand.New(rand.NewSource(seed)),
+	}
+
+	ticks := make([]tick, 0, dataset.TickCount())
+	first := true
+
+	for t := range dataset.Ticks() {
+		q := Quote{
+			Timestamp: t.GetTimestamp(),
+			Bid:       t.GetBid(),
+			Ask:       t.GetAsk(),
+		}
+
+		if first {
+			ctx.reference = q.mid()
+			first = false
+		}
+
+		keep := true
+		for _, p := range s.perturbations {
+			if !p.apply(ctx, &q) {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			ticks = append(ticks, tick{
+				Timestamp: q.Timestamp,
+				Bid:       q.Bid,
+				Ask:       q.Ask,
+			})
+		}
+	}
+
+	return newDataset(dataset.Symbol(), dataset.BeginDate(), dataset.EndDate(), ticks)
+}
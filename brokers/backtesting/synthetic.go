@@ -0,0 +1,236 @@
+package backtesting
+
+import (
+	"fmt"
+	"go-experiments/common"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Trading time in a year, used to scale annualized drift and volatility
+const tradingYear = 260 * 24 * time.Hour
+
+type PriceModel int
+
+const (
+	// PriceModelGBM is a geometric Brownian motion: a random walk on the log price, with drift.
+	PriceModelGBM PriceModel = iota
+
+	// PriceModelMeanReverting is an Ornstein-Uhlenbeck process on the log price, pulled back to MeanPrice.
+	PriceModelMeanReverting
+
+	// PriceModelRegimeSwitching is a geometric Brownian motion whose drift and volatility switch between regimes.
+	PriceModelRegimeSwitching
+)
+
+func (m PriceModel) String() string {
+	switch m {
+	case PriceModelGBM:
+		return "gbm"
+	case PriceModelMeanReverting:
+		return "mean-reverting"
+	case PriceModelRegimeSwitching:
+		return "regime-switching"
+	default:
+		return "unknown"
+	}
+}
+
+// Regime is a market state of the regime switching model.
+type Regime struct {
+	Drift      float64 // Annualized drift
+	Volatility float64 // Annualized volatility
+}
+
+type SyntheticConfig struct {
+	Symbol string
+	Begin  common.Month
+	End    common.Month
+	Seed   int64 // Same seed and config always generate the same dataset
+
+	// Price process
+	Model         PriceModel
+	InitialPrice  float64
+	Drift         float64  // Annualized drift (GBM, mean-reverting)
+	Volatility    float64  // Annualized volatility (GBM, mean-reverting)
+	MeanPrice     float64  // Mean-reverting only: long term price (defaults to InitialPrice)
+	MeanReversion float64  // Mean-reverting only: speed of reversion, per year
+	Regimes       []Regime // Regime switching only: possible regimes, starting with the first one
+	RegimeSwitch  float64  // Regime switching only: probability to switch regime per hour
+
+	// Quotes
+	TickInterval time.Duration // Average interval between ticks (exponentially distributed)
+	Spread       float64       // Spread during liquid hours, in price units
+	Decimals     int           // Number of decimals of quotes (0 to disable rounding)
+
+	// Session patterns (liquid hours are the London and New York sessions)
+	OverlapVolatilityMultiplier float64 // Volatility multiplier when both London and New York sessions are open
+	QuietVolatilityMultiplier   float64 // Volatility multiplier outside of liquid hours
+	QuietSpreadMultiplier       float64 // Spread multiplier outside of liquid hours
+
+	// Gaps
+	MarketHours       bool          // Do not generate ticks while the FX market is closed (weekends, holidays)
+	OutageProbability float64       // Probability per hour to start a data outage
+	OutageDuration    time.Duration // Duration of data outages
+}
+
+// DefaultSyntheticConfig returns an EUR/USD like random walk, to be tweaked by the caller.
+func DefaultSyntheticConfig(symbol string, begin, end common.Month, seed int64) *SyntheticConfig {
+	return &SyntheticConfig{
+		Symbol: symbol,
+		Begin:  begin,
+		End:    end,
+		Seed:   seed,
+
+		Model:         PriceModelGBM,
+		InitialPrice:  1.1,
+		Drift:         0,
+		Volatility:    0.07,
+		MeanReversion: 20,
+		Regimes: []Regime{
+			{Drift: 0, Volatility: 0.05},    // calm
+			{Drift: 0.3, Volatility: 0.08},  // trending up
+			{Drift: -0.3, Volatility: 0.08}, // trending down
+			{Drift: 0, Volatility: 0.15},    // volatile
+		},
+		RegimeSwitch: 0.02,
+
+		TickInterval: 2 * time.Second,
+		Spread:       0.00008,
+		Decimals:     5,
+
+		OverlapVolatilityMultiplier: 1.5,
+		QuietVolatilityMultiplier:   0.5,
+		QuietSpreadMultiplier:       2,
+
+		MarketHours:       true,
+		OutageProbability: 0.001,
+		OutageDuration:    30 * time.Minute,
+	}
+}
+
+// GenerateDataset creates a deterministic synthetic dataset, which can be used in place of historical data.
+func GenerateDataset(config *SyntheticConfig) (*Dataset, error) {
+	if config.InitialPrice <= 0 {
+		return nil, fmt.Errorf("initial price must be greater than 0")
+	}
+	if config.TickInterval <= 0 {
+		return nil, fmt.Errorf("tick interval must be greater than 0")
+	}
+	if config.Model == PriceModelRegimeSwitching && len(config.Regimes) == 0 {
+		return nil, fmt.Errorf("regime switching model requires at least one regime")
+	}
+
+	beginTime := time.Now()
+
+	beginDate := config.Begin.FirstDay()
+	endDate := config.End.LastDay()
+	rng := rand.New(rand.NewSource(config.Seed))
+
+	meanPrice := config.MeanPrice
+	if meanPrice <= 0 {
+		meanPrice = config.InitialPrice
+	}
+
+	logPrice := math.Log(config.InitialPrice)
+	regime := 0
+	ticks := make([]tick, 0)
+
+	// Generate the whole last day
+	end := endDate.AddDate(0, 0, 1)
+	for t := beginDate; t.Before(end); {
+		interval := time.Duration(rng.ExpFloat64() * float64(config.TickInterval))
+		if interval < time.Millisecond {
+			interval = time.Millisecond
+		}
+
+		// Data outage: the price keeps moving but no tick is recorded
+		if rng.Float64() < config.OutageProbability*interval.Hours() {
+			interval += config.OutageDuration
+		}
+
+		next := t.Add(interval)
+		elapsed := interval // Open market time, over which the price moves
+
+		// Market closure: skip to the next open, the closure not counting as elapsed time
+		if config.MarketHours && !common.IsFXMarketOpen(next) {
+			closedSince := next
+			for closedSince.After(t) && !common.IsFXMarketOpen(closedSince.Add(-time.Minute)) {
+				closedSince = closedSince.Add(-time.Minute)
+			}
+			elapsed = closedSince.Sub(t)
+
+			for !common.IsFXMarketOpen(next) {
+				next = next.Add(time.Minute)
+			}
+		}
+
+		// The next open may be after the end, e.g. for months ending on a weekend
+		if !next.Before(end) {
+			break
+		}
+
+		dt := float64(elapsed) / float64(tradingYear)
+		t = next
+
+		liquid := common.LondonSession.IsOpen(t) || common.NYSession.IsOpen(t)
+		volatilityMultiplier := config.QuietVolatilityMultiplier
+		spread := config.Spread * config.QuietSpreadMultiplier
+		if liquid {
+			volatilityMultiplier = 1
+			spread = config.Spread
+			if common.LondonSession.IsOpen(t) && common.NYSession.IsOpen(t) {
+				volatilityMultiplier = config.OverlapVolatilityMultiplier
+			}
+		}
+
+		noise := rng.NormFloat64() * math.Sqrt(dt)
+
+		switch config.Model {
+		case PriceModelGBM:
+			sigma := config.Volatility * volatilityMultiplier
+			logPrice += (config.Drift-sigma*sigma/2)*dt + sigma*noise
+
+		case PriceModelMeanReverting:
+			sigma := config.Volatility * volatilityMultiplier
+			logPrice += config.MeanReversion*(math.Log(meanPrice)-logPrice)*dt + config.Drift*dt + sigma*noise
+
+		case PriceModelRegimeSwitching:
+			if len(config.Regimes) > 1 && rng.Float64() < config.RegimeSwitch*elapsed.Hours() {
+				// Switch to any other regime
+				regime = (regime + 1 + rng.Intn(len(config.Regimes)-1)) % len(config.Regimes)
+			}
+
+			current := config.Regimes[regime]
+			sigma := current.Volatility * volatilityMultiplier
+			logPrice += (current.Drift-sigma*sigma/2)*dt + sigma*noise
+
+		default:
+			return nil, fmt.Errorf("unknown price model: %s", config.Model)
+		}
+
+		mid := math.Exp(logPrice)
+		ticks = append(ticks, tick{
+			Timestamp: t,
+			Bid:       roundPrice(mid-spread/2, config.Decimals),
+			Ask:       roundPrice(mid+spread/2, config.Decimals),
+		})
+	}
+
+	dataset := newDataset(config.Symbol, beginDate, endDate, ticks)
+
+	log.Debug("⏱️  Generated %d ticks in %s.", len(ticks), time.Since(beginTime))
+	log.Info("📈 Generated %s dataset from %s to %s (seed %d)", config.Model, config.Begin.String(), config.End.String(), config.Seed)
+
+	return dataset, nil
+}
+
+func roundPrice(price float64, decimals int) float64 {
+	if decimals <= 0 {
+		return price
+	}
+
+	factor := math.Pow10(decimals)
+	return math.Round(price*factor) / factor
+}
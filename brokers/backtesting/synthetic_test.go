@@ -0,0 +1,203 @@
+package backtesting_test
+
+import (
+	"context"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/runner"
+	"go-experiments/strategies"
+	"go-experiments/traders"
+	"math"
+	"testing"
+	"time"
+)
+
+var syntheticMonth = common.NewMonth(2023, 3)
+
+func syntheticConfig(seed int64) *backtesting.SyntheticConfig {
+	config := backtesting.DefaultSyntheticConfig("SYN", syntheticMonth, syntheticMonth, seed)
+	config.TickInterval = 5 * time.Second
+	return config
+}
+
+func generate(t *testing.T, config *backtesting.SyntheticConfig) *backtesting.Dataset {
+	t.Helper()
+
+	dataset, err := backtesting.GenerateDataset(config)
+	if err != nil {
+		t.Fatalf("failed to generate dataset: %v", err)
+	}
+	if dataset.TickCount() == 0 {
+		t.Fatalf("no tick generated")
+	}
+	return dataset
+}
+
+func collectTicks(dataset *backtesting.Dataset) []backtesting.Tick {
+	ticks := make([]backtesting.Tick, 0, dataset.TickCount())
+	for tick := range dataset.Ticks() {
+		ticks = append(ticks, tick)
+	}
+	return ticks
+}
+
+func TestSyntheticSameSeed(t *testing.T) {
+	a := generate(t, syntheticConfig(42))
+	b := generate(t, syntheticConfig(42))
+
+	if a.Checksum() != b.Checksum() {
+		t.Fatalf("checksums differ for the same seed: %s and %s", a.Checksum(), b.Checksum())
+	}
+
+	ticksA, ticksB := collectTicks(a), collectTicks(b)
+	if len(ticksA) != len(ticksB) {
+		t.Fatalf("tick counts differ for the same seed: %d and %d", len(ticksA), len(ticksB))
+	}
+	for i := range ticksA {
+		if !ticksA[i].GetTimestamp().Equal(ticksB[i].GetTimestamp()) || ticksA[i].GetBid() != ticksB[i].GetBid() || ticksA[i].GetAsk() != ticksB[i].GetAsk() {
+			t.Fatalf("tick %d differs for the same seed", i)
+		}
+	}
+}
+
+func TestSyntheticDifferentSeed(t *testing.T) {
+	a := generate(t, syntheticConfig(42))
+	b := generate(t, syntheticConfig(43))
+
+	if a.Checksum() == b.Checksum() {
+		t.Fatalf("checksums are equal for different seeds")
+	}
+
+	ticksA, ticksB := collectTicks(a), collectTicks(b)
+	for i := range min(len(ticksA), len(ticksB)) {
+		if ticksA[i].GetBid() != ticksB[i].GetBid() {
+			return
+		}
+	}
+	t.Fatalf("ticks are equal for different seeds")
+}
+
+func TestSyntheticGaps(t *testing.T) {
+	// Longest gap of each kind
+	longestGaps := func(config *backtesting.SyntheticConfig) map[backtesting.GapKind]time.Duration {
+		longest := make(map[backtesting.GapKind]time.Duration)
+		for _, gap := range generate(t, config).Gaps() {
+			longest[gap.Kind] = max(longest[gap.Kind], gap.Duration())
+		}
+		return longest
+	}
+
+	config := syntheticConfig(1)
+	config.OutageProbability = 0.05
+	config.OutageDuration = 2 * time.Hour
+	withGaps := longestGaps(config)
+
+	// Random tick intervals may still exceed the maximum gap between ticks now and then, but only by seconds
+	config.MarketHours = false
+	config.OutageProbability = 0
+	withoutGaps := longestGaps(config)
+
+	if withGaps[backtesting.GapKindClosure] < 24*time.Hour {
+		t.Errorf("no weekend closure found with market hours, longest closure %s", withGaps[backtesting.GapKindClosure])
+	}
+	if withGaps[backtesting.GapKindOutage] < config.OutageDuration {
+		t.Errorf("no outage of %s found, longest outage %s", config.OutageDuration, withGaps[backtesting.GapKindOutage])
+	}
+	for kind, duration := range withoutGaps {
+		if duration >= 10*time.Minute {
+			t.Errorf("%s of %s found without market hours nor outages", kind, duration)
+		}
+	}
+}
+
+func TestSyntheticClosures(t *testing.T) {
+	month := common.NewMonth(2024, 8) // Ends on a Saturday
+	config := backtesting.DefaultSyntheticConfig("SYN", month, month, 1)
+	config.TickInterval = 5 * time.Second
+	config.OutageProbability = 0
+	ticks := collectTicks(generate(t, config))
+
+	if last := ticks[len(ticks)-1].GetTimestamp(); !last.Before(month.AddMonths(1).FirstDay()) {
+		t.Fatalf("tick at %s, after the end of %s", last, month)
+	}
+
+	// The price does not move while the market is closed: a weekend of volatility would be about 0.3%
+	closures := 0
+	for i := 1; i < len(ticks); i++ {
+		if ticks[i].GetTimestamp().Sub(ticks[i-1].GetTimestamp()) < 24*time.Hour {
+			continue
+		}
+		closures++
+
+		before := (ticks[i-1].GetBid() + ticks[i-1].GetAsk()) / 2
+		after := (ticks[i].GetBid() + ticks[i].GetAsk()) / 2
+		if move := math.Abs(math.Log(after / before)); move > 0.001 {
+			t.Errorf("price moved by %.4f%% over the closure before %s", move*100, ticks[i].GetTimestamp())
+		}
+	}
+	if closures == 0 {
+		t.Fatalf("no weekend closure found")
+	}
+}
+
+func TestSyntheticSpread(t *testing.T) {
+	config := syntheticConfig(1)
+	tolerance := 1.5 * math.Pow10(-config.Decimals) // Both sides are rounded
+
+	liquid, quiet := 0, 0
+	for _, tick := range collectTicks(generate(t, config)) {
+		spread := tick.GetAsk() - tick.GetBid()
+		switch {
+		case math.Abs(spread-config.Spread) <= tolerance:
+			liquid++
+		case math.Abs(spread-config.Spread*config.QuietSpreadMultiplier) <= tolerance:
+			quiet++
+		default:
+			t.Fatalf("unexpected spread %.6f at %s", spread, tick.GetTimestamp())
+		}
+	}
+
+	if liquid == 0 || quiet == 0 {
+		t.Fatalf("expected both liquid and quiet spreads, got %d liquid and %d quiet ticks", liquid, quiet)
+	}
+}
+
+func TestSyntheticRun(t *testing.T) {
+	config := syntheticConfig(7)
+	config.Model = backtesting.PriceModelRegimeSwitching
+
+	store, err := runner.OpenStore("memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := runner.NewRunnerWithOptions(context.Background(), &runner.Options{
+		Store:  store,
+		Loader: runner.SyntheticLoader(map[string]*backtesting.SyntheticConfig{"SYN": config}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	combo := strategies.BreakoutSpace.GenerateShard(0, strategies.BreakoutSpace.Size())[0]
+	spec := runner.NewRunSpec("SYN", common.MonthRange(syntheticMonth, syntheticMonth), traders.ModularSpec(strategies.BreakoutBuilder(combo)))
+
+	if err := r.SubmitRun(spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := r.FindRun(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run == nil {
+		status, message, _ := r.FindRunStatus(spec)
+		t.Fatalf("run did not succeed: %s %s", status, message)
+	}
+	if run.TotalTrades == 0 {
+		t.Fatalf("no trade on the synthetic dataset")
+	}
+}
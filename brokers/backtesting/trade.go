@@ -0,0 +1,51 @@
+package backtesting
+
+import (
+	"fmt"
+	"go-experiments/brokers"
+	"time"
+)
+
+// Trade is a closed position of a backtest.
+type Trade struct {
+	Direction  brokers.PositionDirection
+	Quantity   int
+	OpenTime   time.Time
+	OpenPrice  float64
+	CloseTime  time.Time
+	ClosePrice float64
+	StopLoss   float64
+	TakeProfit float64
+	ExitReason CloseTrigger
+	PnL        float64 // Net of commissions
+}
+
+// Trades returns all closed positions of the backtest, in opening order.
+func Trades(b brokers.BacktestingBroker) ([]*Trade, error) {
+	bb, ok := b.(*broker)
+	if !ok {
+		return nil, fmt.Errorf("invalid broker type: expected *broker, got %T", b)
+	}
+
+	trades := make([]*Trade, 0, len(bb.positionsHistory))
+	for _, pos := range bb.positionsHistory {
+		if !pos.closed {
+			continue
+		}
+
+		trades = append(trades, &Trade{
+			Direction:  pos.direction,
+			Quantity:   pos.quantity,
+			OpenTime:   pos.openTime,
+			OpenPrice:  pos.openPrice,
+			CloseTime:  pos.closeTime,
+			ClosePrice: pos.closePrice,
+			StopLoss:   pos.stopLoss,
+			TakeProfit: pos.takeProfit,
+			ExitReason: pos.closeTrigger,
+			PnL:        pos.getProfitAndLoss(),
+		})
+	}
+
+	return trades, nil
+}
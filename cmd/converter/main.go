@@ -3,10 +3,13 @@ package main
 import (
 	"archive/zip"
 	"encoding/csv"
+	"flag"
 	"fmt"
+	"go-experiments/brokers/backtesting"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -99,7 +102,43 @@ func loadCsvZip(zipFile string) ([]parquetTick, error) {
 	return ticks, nil
 }
 
-func writeParquet(filename string, ticks []parquetTick) error {
+func toQuotes(ticks []parquetTick) []backtesting.Quote {
+	quotes := make([]backtesting.Quote, len(ticks))
+	for i, tick := range ticks {
+		quotes[i] = backtesting.Quote{
+			Timestamp: time.UnixMilli(tick.Timestamp),
+			Bid:       tick.Bid,
+			Ask:       tick.Ask,
+		}
+	}
+
+	return quotes
+}
+
+func fromQuotes(quotes []backtesting.Quote) []parquetTick {
+	ticks := make([]parquetTick, len(quotes))
+	for i, quote := range quotes {
+		ticks[i] = parquetTick{
+			Timestamp: quote.Timestamp.UnixMilli(),
+			Bid:       quote.Bid,
+			Ask:       quote.Ask,
+		}
+	}
+
+	return ticks
+}
+
+func cleanTicks(ticks []parquetTick, config *backtesting.CleaningConfig) []parquetTick {
+	quotes, report := backtesting.CleanQuotes(toQuotes(ticks), config)
+
+	for _, month := range report.Months() {
+		fmt.Printf("🧹 Cleaned %s: %s\n", month.String(), report[month].String())
+	}
+
+	return fromQuotes(quotes)
+}
+
+func writeParquet[Row any](filename string, rows []Row) error {
 	// Create file
 	fw, err := local.NewLocalFileWriter(filename)
 	if err != nil {
@@ -108,7 +147,7 @@ func writeParquet(filename string, ticks []parquetTick) error {
 	defer fw.Close()
 
 	// Create Parquet writer
-	pw, err := writer.NewParquetWriter(fw, new(parquetTick), 4)
+	pw, err := writer.NewParquetWriter(fw, new(Row), 4)
 	if err != nil {
 		return err
 	}
@@ -117,18 +156,26 @@ func writeParquet(filename string, ticks []parquetTick) error {
 	pw.RowGroupSize = 128 * 1024 * 1024 // 128MB
 	pw.CompressionType = parquet.CompressionCodec_SNAPPY
 
-	// Write all ticks
-	for _, tick := range ticks {
-		if err := pw.Write(tick); err != nil {
+	// Write all rows
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
 			return err
 		}
 	}
 
-	fmt.Printf("📊 Wrote %d ticks to %s\n", len(ticks), filename)
+	fmt.Printf("📊 Wrote %d rows to %s\n", len(rows), filename)
 	return nil
 }
 
-func convertMissingParquetFiles() error {
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// zipNamePattern matches e.g. HISTDATA_COM_ASCII_EURUSD_T202401.zip
+var zipNamePattern = regexp.MustCompile(`^HISTDATA_COM_ASCII_([A-Z0-9]+)_T(\d{4})(\d{2})\.zip$`)
+
+func convertMissingParquetFiles(cleaning *backtesting.CleaningConfig) error {
 	files, err := filepath.Glob(filepath.Join(dataPath, "HISTDATA_COM_ASCII_*.zip"))
 	if err != nil {
 		return fmt.Errorf("failed to list zip files: %v", err)
@@ -136,24 +183,59 @@ func convertMissingParquetFiles() error {
 
 	for _, zipFile := range files {
 		base := filepath.Base(zipFile)
-		base = strings.Replace(base, "HISTDATA_COM_ASCII_", "HISTDATA_COM_", 1)
-		parquetName := strings.TrimSuffix(base, ".zip") + ".parquet"
+		match := zipNamePattern.FindStringSubmatch(base)
+		if match == nil {
+			fmt.Printf("⚠️ Skipping %s: not a HISTDATA tick archive (e.g. HISTDATA_COM_ASCII_EURUSD_T202401.zip)\n", base)
+			continue
+		}
+		symbol := match[1]
+		year, _ := strconv.Atoi(match[2])
+		month, _ := strconv.Atoi(match[3])
+
+		parquetName := backtesting.TickFileName(symbol, year, month)
 		parquetPath := filepath.Join(dataPath, parquetName)
+		candleName := backtesting.CandleFileName(symbol, year, month)
+		candlePath := filepath.Join(dataPath, candleName)
 
-		if _, err := os.Stat(parquetPath); err == nil {
-			fmt.Printf("✅ Parquet exists: %s (skipping)\n", parquetName)
+		ticksExist := fileExists(parquetPath)
+		candlesExist := fileExists(candlePath)
+
+		if ticksExist && candlesExist {
+			fmt.Printf("✅ Parquet exists: %s, %s (skipping)\n", parquetName, candleName)
 			continue
 		}
 
-		fmt.Printf("📦 Converting: %s → %s\n", base, parquetName)
+		var quotes []backtesting.Quote
+		if ticksExist {
+			// Candles must match the tick file read by the drill-down, not a new conversion of the archive
+			fmt.Printf("📦 Building candles: %s → %s\n", parquetName, candleName)
 
-		ticks, err := loadCsvZip(zipFile)
-		if err != nil {
-			return fmt.Errorf("failed to load CSV: %v", err)
+			if quotes, err = backtesting.ReadTickFile(parquetPath); err != nil {
+				return fmt.Errorf("failed to read ticks: %v", err)
+			}
+		} else {
+			fmt.Printf("📦 Converting: %s → %s, %s\n", base, parquetName, candleName)
+
+			ticks, err := loadCsvZip(zipFile)
+			if err != nil {
+				return fmt.Errorf("failed to load CSV: %v", err)
+			}
+
+			if cleaning != nil {
+				ticks = cleanTicks(ticks, cleaning)
+			}
+
+			if err := writeParquet(parquetPath, ticks); err != nil {
+				return fmt.Errorf("failed to write parquet: %v", err)
+			}
+			quotes = toQuotes(ticks)
 		}
 
-		if err := writeParquet(parquetPath, ticks); err != nil {
-			return fmt.Errorf("failed to write parquet: %v", err)
+		if !candlesExist {
+			candles := backtesting.BuildCandleRows(quotes)
+			if err := writeParquet(candlePath, candles); err != nil {
+				return fmt.Errorf("failed to write candle parquet: %v", err)
+			}
 		}
 	}
 
@@ -161,8 +243,16 @@ func convertMissingParquetFiles() error {
 }
 
 func main() {
+	clean := flag.Bool("clean", false, "Clean raw ticks (crossed quotes, zero prices, duplicates, out of order rows, spikes) before writing")
+	flag.Parse()
+
+	var cleaning *backtesting.CleaningConfig
+	if *clean {
+		cleaning = backtesting.DefaultCleaningConfig()
+	}
+
 	// Convert all csv files where the target does not exist
-	err := convertMissingParquetFiles()
+	err := convertMissingParquetFiles(cleaning)
 	if err != nil {
 		fmt.Printf("❌ Conversion failed: %v\n", err)
 	}
@@ -58,6 +58,31 @@ func main() {
 	}
 
 	doplot(buckets)
+	printGaps(dataset.Gaps())
+}
+
+func printGaps(gaps []backtesting.Gap) {
+	fmt.Printf("\n⏳ Gaps\n")
+	fmt.Printf("=======\n")
+
+	durations := make(map[backtesting.GapKind]time.Duration)
+	counts := make(map[backtesting.GapKind]int)
+
+	for _, gap := range gaps {
+		durations[gap.Kind] += gap.Duration()
+		counts[gap.Kind]++
+
+		if gap.Kind == backtesting.GapKindOutage {
+			fmt.Printf("❌ Outage from %s to %s (%s)\n",
+				gap.Begin.Format("2006-01-02 15:04:05"),
+				gap.End.Format("2006-01-02 15:04:05"),
+				gap.Duration().String())
+		}
+	}
+
+	for _, kind := range []backtesting.GapKind{backtesting.GapKindClosure, backtesting.GapKindOutage} {
+		fmt.Printf("📊 %s: %d gap(s), total %s\n", kind, counts[kind], durations[kind].String())
+	}
 }
 
 // weekendBand implements plot.Plotter
@@ -1,64 +1,281 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"go-experiments/brokers/backtesting"
 	"go-experiments/common"
 	"go-experiments/gridsearch"
 	"go-experiments/runner"
 	"go-experiments/strategies"
-	"go-experiments/traders/modular"
-	"go-experiments/traders/modular/indicators"
-	"go-experiments/traders/modular/ordercomputer"
+	"go-experiments/traders"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
 	instrument := "EURUSD"
 
-	months := []common.Month{
-		common.NewMonth(2023, 1),
-		common.NewMonth(2023, 2),
-		common.NewMonth(2023, 3),
-		common.NewMonth(2023, 4),
-		common.NewMonth(2023, 5),
-		common.NewMonth(2023, 6),
+	rangesFlag := flag.String("ranges", "", "Comma separated time ranges to run (e.g. 2023-01..2023-03,2023-04), defaults to each month of 2023-H1")
+	storeFlag := flag.String("store", "", "Results store: sqlite:<path>, csv:<dir> or memory, defaults to output/data.db")
+	workers := flag.Int("workers", 0, "Number of concurrent runs, defaults to the number of CPU cores (64 in coordinator mode)")
+	queueSize := flag.Int("queue", 0, "Number of pending runs before submission blocks, defaults to twice the number of workers")
+	retryFailed := flag.Bool("retry-failed", false, "Run again runs which failed previously (succeeded runs are always skipped, so an interrupted sweep can be resumed)")
+	cacheMB := flag.Int64("cache-mb", 0, "Memory budget of the dataset cache in MB, defaults to 4096")
+	leverageFlag := flag.String("leverage", "", "Comma separated leverages to sweep, defaults to the runner default")
+	capitalFlag := flag.String("capital", "", "Comma separated initial capitals to sweep, defaults to the runner default")
+	commissionFlag := flag.String("commission", "0", "Comma separated commissions per lot and per side to sweep")
+	slippageFlag := flag.String("slippage", "0", "Comma separated slippages in price units to sweep")
+	candles := flag.Bool("candles", false, "Drive the backtests from precomputed M1 candles instead of ticks, much faster for sweeps")
+	intrabar := flag.String("intrabar", backtesting.IntrabarWorstCase.String(), "Candle mode: resolution when a candle touches both stop loss and take profit (worst-case, ohlc-path, tick-drilldown)")
+	serve := flag.String("serve", "", "Coordinator mode: serve runs to workers on this address (e.g. :8080) instead of running them locally")
+	shardFlag := flag.String("shard", "", "Grid search: run only a shard of the combos, e.g. 2/4 for the second of four, to split a sweep between processes")
+	searchFlag := flag.String("search", "grid", "Search strategy: "+strings.Join(gridsearch.SearchNames, ", ")+" (lhs for Latin hypercube, tpe for Bayesian), tpe and genetic being guided by completed runs")
+	budget := flag.Int("budget", 0, "Number of combos to run with random, lhs and tpe searches, defaults to all combos")
+	seed := flag.Int64("seed", 1, "Seed of random, lhs, tpe and genetic searches")
+	batchSize := flag.Int("batch", 32, "Number of combos proposed at a time by the tpe search, which learns from the results of previous batches")
+	population := flag.Int("population", 50, "Genetic search: number of combos per generation")
+	generations := flag.Int("generations", 20, "Genetic search: number of generations")
+	objectiveFlag := flag.String("objective", "net-pnl", "Comma separated objectives ranking combos (averaged over their runs) and guiding tpe and genetic searches, several ones being ranked by Pareto front: "+strings.Join(runner.ObjectiveNames(), ", "))
+	minTrades := flag.Int("min-trades", 0, "Runs with fewer trades score worst on every objective")
+	abortDrawdown := flag.Float64("abort-drawdown", 0, "Prune runs once closed-trade equity drops this much from its peak, in percent (0 to disable)")
+	abortMinTrades := flag.Int("abort-min-trades", 0, "Prune runs with fewer trades than this once -abort-min-trades-after has elapsed (0 to disable)")
+	abortMinTradesAfter := flag.Duration("abort-min-trades-after", 7*24*time.Hour, "Time since the start of a run at which -abort-min-trades is checked")
+	abortLosses := flag.Int("abort-losses", 0, "Prune runs after this many consecutive losing trades (0 to disable)")
+	lease := flag.Duration("lease", 0, "Coordinator mode: time after which a run not completed by its worker is handed out again, defaults to 30m")
+	flag.Parse()
+
+	brokerConfigs, err := sweepBrokerConfigs(*leverageFlag, *capitalFlag, *commissionFlag, *slippageFlag)
+	if err != nil {
+		panic(err)
 	}
 
-	runner, err := runner.NewRunner()
+	intrabarResolution, err := backtesting.ParseIntrabarResolution(*intrabar)
 	if err != nil {
 		panic(err)
 	}
-	defer runner.Close()
+	for i := range brokerConfigs {
+		brokerConfigs[i].Candles, brokerConfigs[i].Intrabar = *candles, intrabarResolution
+	}
 
-	combos := strategies.BreakoutSpace.GenerateCombinations()
+	if *abortDrawdown > 0 || *abortMinTrades > 0 || *abortLosses > 0 {
+		rules := &backtesting.AbortRules{MaxDrawdownPct: *abortDrawdown, MaxConsecutiveLosses: *abortLosses}
+		if *abortMinTrades > 0 {
+			rules.MinTrades, rules.MinTradesAfter = *abortMinTrades, *abortMinTradesAfter
+		}
+		for i := range brokerConfigs {
+			brokerConfigs[i].Abort = rules
+		}
+	}
 
-	fmt.Printf("Combined %d strategies\n", len(combos))
+	timeRanges := make([]common.TimeRange, 0)
+	if *rangesFlag == "" {
+		for month := common.NewMonth(2023, 1); month.Before(common.NewMonth(2023, 7)); month = month.AddMonths(1) {
+			timeRanges = append(timeRanges, common.MonthRange(month, month))
+		}
+	} else {
+		for _, s := range strings.Split(*rangesFlag, ",") {
+			timeRange, err := common.ParseTimeRange(strings.TrimSpace(s))
+			if err != nil {
+				panic(err)
+			}
+			timeRanges = append(timeRanges, timeRange)
+		}
+	}
+
+	store, err := runner.OpenStore(*storeFlag)
+	if err != nil {
+		panic(err)
+	}
+
+	// On interrupt, pending runs are skipped and running ones complete
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	options := &runner.Options{
+		Store:       store,
+		CacheBudget: *cacheMB << 20,
+		RetryFailed: *retryFailed,
+		Pool:        runner.PoolOptions{Workers: *workers, QueueSize: *queueSize},
+	}
 
-	for _, combo := range combos {
-		for _, month := range months {
-			strategy := buildStrategy(combo)
-			if err := runner.SubmitRun(instrument, month, strategy); err != nil {
+	if *serve != "" {
+		// Each run in progress on a worker holds a pool slot
+		if options.Pool.Workers == 0 {
+			options.Pool.Workers = 64
+		}
+
+		coordinator := runner.NewCoordinator(*lease)
+		options.Executor = coordinator
+
+		server := &http.Server{Addr: *serve, Handler: coordinator.Handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				panic(err)
 			}
+		}()
+		defer server.Close()
+
+		fmt.Printf("Serving runs to workers on %s\n", *serve)
+	}
+
+	r, err := runner.NewRunnerWithOptions(ctx, options)
+	if err != nil {
+		panic(err)
+	}
+
+	space := strategies.BreakoutSpace
+	if err := space.ValidateBuild(func(combo gridsearch.Combo) { strategies.BreakoutBuilder(combo) }); err != nil {
+		panic(err)
+	}
+
+	objectives, err := runner.ParseObjectives(*objectiveFlag, *minTrades)
+	if err != nil {
+		panic(err)
+	}
+
+	shard, shards, err := parseShard(*shardFlag)
+	if err != nil {
+		panic(err)
+	}
+	search, err := gridsearch.NewSearch(*searchFlag, space, &gridsearch.SearchOptions{
+		Budget: *budget, Seed: *seed, Shard: shard, Shards: shards, Population: *population, Generations: *generations,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	batch := 0 // All remaining combos at once, each generation for the genetic search
+	total := space.Size()
+
+	switch *searchFlag {
+	case "grid":
+		total = len(space.GenerateShard(shard, shards))
+	case "tpe":
+		batch = max(1, *batchSize)
+	case "genetic":
+		total = min(total, *population**generations)
+	}
+
+	if *searchFlag != "grid" && *searchFlag != "genetic" && *budget > 0 && *budget < total {
+		total = *budget
+	}
+
+	fmt.Printf("Searching %d of %d strategies (%s)\n", total, space.Size(), *searchFlag)
+	r.ExpectRuns(total * len(timeRanges) * len(brokerConfigs))
+
+	done := make(chan struct{})
+	go reportProgress(r, done)
+
+	result, err := r.Optimize(&runner.OptimizeOptions{
+		Search: search,
+		Batch:  batch,
+		Specs: func(combo gridsearch.Combo) []*runner.RunSpec {
+			specs := make([]*runner.RunSpec, 0, len(timeRanges)*len(brokerConfigs))
+			for _, timeRange := range timeRanges {
+				for _, brokerConfig := range brokerConfigs {
+					specs = append(specs, &runner.RunSpec{
+						Instrument: instrument,
+						TimeRange:  timeRange,
+						Trader:     traders.ModularSpec(strategies.BreakoutBuilder(combo)),
+						Broker:     brokerConfig,
+						Params:     combo,
+					})
+				}
+			}
+			return specs
+		},
+		Objectives: objectives,
+	})
+	if err != nil {
+		fmt.Printf("Stopped submitting runs: %v\n", err)
+	}
+
+	r.Close()
+	close(done)
+
+	fmt.Printf("Done: %s\n", r.Progress())
+	if best := result.Best(); best != nil {
+		fmt.Printf("Best combo: %v (mean %s)\n", best.Combo, runner.FormatScores(*objectiveFlag, best.Scores))
+	}
+	if front := result.Front(); len(objectives) > 1 && len(front) > 0 {
+		fmt.Printf("Pareto front (%d combos):\n", len(front))
+		for _, scored := range front[:min(len(front), 20)] {
+			fmt.Printf("  %s: %v\n", runner.FormatScores(*objectiveFlag, scored.Scores), scored.Combo)
 		}
 	}
 }
 
-func buildStrategy(combo gridsearch.Combo) modular.Builder {
-	builder := modular.NewBuilder()
-	builder.SetHistorySize(250)
+// parseShard parses a 1-based shard such as "2/4", returning the 0-based index and the count.
+func parseShard(s string) (int, int, error) {
+	if s == "" {
+		return 0, 1, nil
+	}
+
+	var index, count int
+	if _, err := fmt.Sscanf(s, "%d/%d", &index, &count); err != nil || count <= 0 || index < 1 || index > count {
+		return 0, 0, fmt.Errorf("invalid shard '%s', expected e.g. 2/4", s)
+	}
+	return index - 1, count, nil
+}
+
+// sweepBrokerConfigs returns all combinations of the comma separated values.
+func sweepBrokerConfigs(leverages, capitals, commissions, slippages string) ([]backtesting.Config, error) {
+	defaults := runner.DefaultBrokerConfig()
+	if leverages == "" {
+		leverages = strconv.FormatFloat(defaults.Leverage, 'g', -1, 64)
+	}
+	if capitals == "" {
+		capitals = strconv.FormatFloat(defaults.InitialCapital, 'g', -1, 64)
+	}
+
+	values := make([][]float64, 0, 4)
+	for _, list := range []string{leverages, capitals, commissions, slippages} {
+		floats := make([]float64, 0)
+		for _, s := range strings.Split(list, ",") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid broker setting '%s': %w", s, err)
+			}
+			floats = append(floats, value)
+		}
+		values = append(values, floats)
+	}
 
-	strategies.BreakoutGS(builder.Strategy(), combo)
+	configs := make([]backtesting.Config, 0)
+	for _, leverage := range values[0] {
+		for _, capital := range values[1] {
+			for _, commission := range values[2] {
+				for _, slippage := range values[3] {
+					config := defaults
+					config.Leverage = leverage
+					config.InitialCapital = capital
+					config.Commission = commission
+					config.Slippage = slippage
+					configs = append(configs, config)
+				}
+			}
+		}
+	}
 
-	builder.RiskManager().SetStopLoss(
-		ordercomputer.StopLossATR(indicators.ATR(14), 1.0),
-		//ordercomputer.StopLossPipBuffer(3, 15),
-	).SetTakeProfit(
-		ordercomputer.TakeProfitRatio(2.0),
-	)
+	return configs, nil
+}
 
-	builder.CapitalAllocator().SetAllocator(
-		ordercomputer.CapitalFixed(10),
-	)
+func reportProgress(r *runner.Runner, done <-chan struct{}) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 
-	return builder
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Printf("Progress: %s\n", r.Progress())
+		case <-done:
+			return
+		}
+	}
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-experiments/reports"
+	"go-experiments/runner"
+	"go-experiments/traders"
+	"os"
+)
+
+func main() {
+	storeFlag := flag.String("store", "", "Results store: sqlite:<path>, csv:<dir> or memory, defaults to output/data.db")
+	instrument := flag.String("instrument", "", "Only rank runs of this instrument, defaults to all instruments")
+	minMonths := flag.Int("min-months", 3, "Leave out strategies run on fewer months")
+	top := flag.Int("top", 20, "Number of strategies to print (all are exported)")
+	csvPath := flag.String("csv", "", "Export the leaderboard to this CSV file, with the PnL of each month")
+	splits := flag.Int("cscv-splits", 0, "Even number of month blocks cross-validated for the probability of overfitting, at most 16, 0 for as many as possible")
+	flag.Parse()
+
+	store, err := runner.OpenStore(*storeFlag)
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+
+	leaderboard, err := reports.ConsistencyLeaderboard(store, &reports.ConsistencyOptions{
+		Instrument: *instrument,
+		MinMonths:  *minMonths,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("\n🏆 Consistency leaderboard (%d strategies)\n", len(leaderboard))
+	fmt.Printf("==================================\n")
+	fmt.Printf("%4s %-8s %6s %11s %-20s %10s %10s %10s %7s %7s %6s  %s\n",
+		"#", "Instr.", "Months", "Profitable", "Worst month", "Mean PnL", "Std dev", "Total PnL", "Trades", "Sharpe", "DSR", "Strategy")
+
+	for i, entry := range leaderboard[:min(*top, len(leaderboard))] {
+		worst := fmt.Sprintf("%s %.2f", entry.WorstMonth.Month, entry.WorstMonth.Metrics.NetPnL)
+		fmt.Printf("%4d %-8s %6d %10.1f%% %-20s %10.2f %10.2f %10.2f %7d %7.2f %6.2f  %s\n",
+			i+1, entry.Instrument, len(entry.Months), entry.ProfitableMonths, worst,
+			entry.MeanPnL, entry.StdDevPnL, entry.TotalPnL, entry.TotalTrades, entry.Sharpe, entry.DeflatedSharpe, describe(entry))
+	}
+
+	printOverfitting(leaderboard, *splits)
+
+	if *csvPath != "" {
+		file, err := os.Create(*csvPath)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+
+		if err := reports.WriteConsistencyCSV(file, leaderboard); err != nil {
+			panic(err)
+		}
+		fmt.Printf("\nExported %d strategies to %s\n", len(leaderboard), *csvPath)
+	}
+}
+
+// printOverfitting reports how much the best backtests of the leaderboard are expected to owe to chance, for each
+// instrument and broker config since only strategies run on the same data are trials of the same selection.
+func printOverfitting(leaderboard []*reports.Consistency, splits int) {
+	fmt.Printf("\n🎲 Overfitting diagnostics\n")
+	fmt.Printf("=========================\n")
+
+	for _, trials := range reports.Trials(leaderboard) {
+		fmt.Printf("\n%s with broker config %s (%d strategies)\n", trials[0].Instrument, trials[0].BrokerConfig, len(trials))
+		fmt.Printf("Best monthly Sharpe expected by chance: %.2f (DSR is the probability to beat it)\n",
+			reports.ExpectedMaxSharpe(reports.Sharpes(trials)))
+
+		overfitting, err := reports.ProbabilityOfOverfitting(trials, splits)
+		if err != nil {
+			fmt.Printf("⚠️ Probability of backtest overfitting not computed: %v\n", err)
+			continue
+		}
+		fmt.Printf("Probability of backtest overfitting: %.1f%% (%d months in %d blocks, %d combinations)\n",
+			overfitting.PBO*100, len(overfitting.Months), overfitting.Splits, overfitting.Combinations)
+		fmt.Printf("Probability of out-of-sample loss of the best in-sample strategy: %.1f%%\n", overfitting.ProbabilityOfLoss*100)
+		if overfitting.PBO > 0.5 {
+			fmt.Printf("⚠️ Picking the best backtest does worse out-of-sample than picking at random\n")
+		}
+	}
+}
+
+// describe returns the parameters the strategy was built from, or its compact description.
+func describe(entry *reports.Consistency) string {
+	if entry.Params != "" {
+		return entry.Params
+	}
+
+	spec, err := traders.SpecFromJSON([]byte(entry.Strategy))
+	if err != nil {
+		return entry.Strategy
+	}
+	return spec.Format().Compact()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/strategies"
+	"go-experiments/traders"
+	"go-experiments/traders/modular"
+	"go-experiments/traders/modular/indicators"
+	"go-experiments/traders/modular/ordercomputer"
+	"math"
+)
+
+// Run the breakout strategy on random walks: a strategy should not find an edge in noise.
+func main() {
+	seeds := flag.Int("seeds", 10, "Number of synthetic datasets to run")
+	model := flag.String("model", backtesting.PriceModelGBM.String(), "Price model (gbm, mean-reverting, regime-switching)")
+	flag.Parse()
+
+	var priceModel backtesting.PriceModel
+	switch *model {
+	case backtesting.PriceModelGBM.String():
+		priceModel = backtesting.PriceModelGBM
+	case backtesting.PriceModelMeanReverting.String():
+		priceModel = backtesting.PriceModelMeanReverting
+	case backtesting.PriceModelRegimeSwitching.String():
+		priceModel = backtesting.PriceModelRegimeSwitching
+	default:
+		panic(fmt.Sprintf("unknown price model: %s", *model))
+	}
+
+	pnls := make([]float64, 0, *seeds)
+
+	for seed := 1; seed <= *seeds; seed++ {
+		config := backtesting.DefaultSyntheticConfig("SYNTHETIC", common.NewMonth(2024, 1), common.NewMonth(2024, 1), int64(seed))
+		config.Model = priceModel
+
+		dataset, err := backtesting.GenerateDataset(config)
+		if err != nil {
+			panic(err)
+		}
+
+		pnl, trades := run(dataset)
+		pnls = append(pnls, pnl)
+
+		fmt.Printf("🎲 Seed %d: PnL %.2f (Trades: %d)\n", seed, pnl, trades)
+	}
+
+	mean, stdDev := meanStdDev(pnls)
+	tStat := 0.0
+	if stdDev > 0 {
+		tStat = mean / (stdDev / math.Sqrt(float64(len(pnls))))
+	}
+
+	fmt.Printf("\n📊 Mean PnL: %.2f, StdDev: %.2f, t-stat: %.2f\n", mean, stdDev, tStat)
+	// Losing on noise is expected because of the spread, only a profit is suspicious
+	if tStat > 2 {
+		fmt.Printf("⚠️  The strategy seems to find an edge in noise, check for bugs or look-ahead bias\n")
+	}
+}
+
+func run(dataset *backtesting.Dataset) (float64, int) {
+	brokerConfig := &backtesting.Config{
+		LotSize:        1,
+		Leverage:       30.0,
+		InitialCapital: 100000,
+	}
+
+	broker, err := backtesting.NewBroker(brokerConfig, dataset)
+	if err != nil {
+		panic(err)
+	}
+
+	builder := modular.NewBuilder()
+	builder.SetHistorySize(250)
+
+	strategies.Breakout(builder.Strategy())
+
+	builder.RiskManager().SetStopLoss(
+		ordercomputer.StopLossATR(indicators.ATR(14), 1.0),
+	).SetTakeProfit(
+		ordercomputer.TakeProfitRatio(2.0),
+	)
+
+	builder.CapitalAllocator().SetAllocator(
+		ordercomputer.CapitalFixed(10),
+	)
+
+	if err := traders.SetupModularTrader(broker, builder); err != nil {
+		panic(err)
+	}
+	if err := broker.Run(); err != nil {
+		panic(err)
+	}
+
+	metrics, err := backtesting.ComputeMetrics(broker)
+	if err != nil {
+		panic(err)
+	}
+
+	pnl := 0.0
+	trades := 0
+	for _, m := range metrics {
+		pnl += m.NetPnL
+		trades += m.TotalTrades
+	}
+
+	return pnl, trades
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	if len(values) > 1 {
+		variance /= float64(len(values) - 1)
+	}
+
+	return mean, math.Sqrt(variance)
+}
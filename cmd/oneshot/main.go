@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"go-experiments/brokers"
 	"go-experiments/brokers/backtesting"
 	"go-experiments/common"
 	"go-experiments/strategies"
@@ -13,16 +15,20 @@ import (
 )
 
 func main() {
-	dataset, err := backtesting.LoadDataset(
-		common.NewMonth(2024, 1),
-		common.NewMonth(2024, 12),
-		"EURUSD",
-	)
+	candles := flag.Bool("candles", false, "Drive the backtest from precomputed M1 candles instead of ticks")
+	intrabar := flag.String("intrabar", backtesting.IntrabarWorstCase.String(), "Candle mode: resolution when a candle touches both stop loss and take profit (worst-case, ohlc-path, tick-drilldown)")
+	commission := flag.Float64("commission", 0, "Commission per lot and per side, in account currency")
+	slippage := flag.Float64("slippage", 0, "Adverse price move on every fill, in price units")
+	flag.Parse()
 
+	intrabarResolution, err := backtesting.ParseIntrabarResolution(*intrabar)
 	if err != nil {
 		panic(err)
 	}
 
+	begin := common.NewMonth(2024, 1)
+	end := common.NewMonth(2024, 12)
+
 	brokerConfig := &backtesting.Config{
 		// For backtesting, we assume a lot size of 1 for simplicity.
 		// In a real broker, this would be the number of units per lot.
@@ -36,11 +42,36 @@ func main() {
 		Leverage: 30.0,
 
 		InitialCapital: 100000,
+
+		Candles:  *candles,
+		Intrabar: intrabarResolution,
+
+		Commission: *commission,
+		Slippage:   *slippage,
 	}
 
-	broker, err := backtesting.NewBroker(brokerConfig, dataset)
-	if err != nil {
-		panic(err)
+	var broker brokers.BacktestingBroker
+
+	if *candles {
+		dataset, err := backtesting.LoadCandleDataset(begin, end, "EURUSD")
+		if err != nil {
+			panic(err)
+		}
+
+		broker, err = backtesting.NewCandleBroker(brokerConfig, dataset)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		dataset, err := backtesting.LoadDataset(begin, end, "EURUSD")
+		if err != nil {
+			panic(err)
+		}
+
+		broker, err = backtesting.NewBroker(brokerConfig, dataset)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	builder := modular.NewBuilder()
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-experiments/brokers"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/runner"
+	"go-experiments/strategies"
+	"go-experiments/traders"
+	"go-experiments/traders/modular"
+	"go-experiments/traders/modular/indicators"
+	"go-experiments/traders/modular/ordercomputer"
+	"slices"
+)
+
+func main() {
+	count := flag.Int("n", 20, "Number of scenarios to run")
+	seed := flag.Int64("seed", 1, "Seed of the first scenario")
+	noise := flag.Float64("noise", 0.00002, "Standard deviation of the price noise, in price units (0 to disable)")
+	spread := flag.Float64("news-spread", 3, "Spread multiplier around news releases (1 to disable)")
+	dropout := flag.Float64("dropout", 0.05, "Probability to drop a tick (0 to disable)")
+	shift := flag.Duration("shift", 0, "Time shift of all ticks")
+	invert := flag.Bool("invert", false, "Invert prices to test directional bias")
+	flag.Parse()
+
+	dataset, err := backtesting.LoadDataset(
+		common.NewMonth(2024, 1),
+		common.NewMonth(2024, 1),
+		"EURUSD",
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	perturbations := make([]backtesting.Perturbation, 0)
+	if *noise > 0 {
+		perturbations = append(perturbations, backtesting.PriceNoise(*noise))
+	}
+	if *spread != 1 {
+		perturbations = append(perturbations, backtesting.WidenedSpread(*spread, backtesting.NewsSessions...))
+	}
+	if *dropout > 0 {
+		perturbations = append(perturbations, backtesting.Dropout(*dropout))
+	}
+	if *shift != 0 {
+		perturbations = append(perturbations, backtesting.TimeShift(*shift))
+	}
+	if *invert {
+		perturbations = append(perturbations, backtesting.Invert())
+	}
+
+	scenario := backtesting.NewScenario(perturbations...)
+
+	brokerConfig := &backtesting.Config{
+		LotSize:        1,
+		Leverage:       30.0,
+		InitialCapital: 100000,
+	}
+
+	setup := func(broker brokers.Broker) error {
+		return traders.SetupModularTrader(broker, buildStrategy())
+	}
+
+	// Baseline on unperturbed data
+	baseline, err := runner.RunScenarios(dataset, brokerConfig, setup, backtesting.NewScenario(), 1, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	results, err := runner.RunScenarios(dataset, brokerConfig, setup, scenario, *count, *seed)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("\n🌪️  %s, %d runs\n", scenario.String(), *count)
+	fmt.Printf("==================\n")
+
+	distributions := runner.ScenarioDistributions(results)
+	baselineDistributions := runner.ScenarioDistributions(baseline)
+
+	names := make([]string, 0, len(distributions))
+	for name := range distributions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		fmt.Printf("📊 %-15s baseline=%.2f, %s\n", name, baselineDistributions[name].Mean, distributions[name].String())
+	}
+}
+
+func buildStrategy() modular.Builder {
+	builder := modular.NewBuilder()
+	builder.SetHistorySize(250)
+
+	strategies.Breakout(builder.Strategy())
+
+	builder.RiskManager().SetStopLoss(
+		ordercomputer.StopLossATR(indicators.ATR(14), 1.0),
+	).SetTakeProfit(
+		ordercomputer.TakeProfitRatio(2.0),
+	)
+
+	builder.CapitalAllocator().SetAllocator(
+		ordercomputer.CapitalFixed(10),
+	)
+
+	return builder
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-experiments/common"
+	"go-experiments/reports"
+	"go-experiments/runner"
+	"go-experiments/strategies"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	storeFlag := flag.String("store", "", "Results store: sqlite:<path>, csv:<dir> or memory, defaults to output/data.db")
+	instrument := flag.String("instrument", "", "Only use runs of this instrument, required if runs have several")
+	rangesFlag := flag.String("ranges", "", "Only use runs of these comma separated time ranges of the same length (e.g. 2023-01,2023-02), defaults to all time ranges")
+	brokerFlag := flag.String("broker", "", "Only use runs with this broker config, as stored in JSON, required if runs have several")
+	xFlag := flag.String("x", "", "Parameter on the x axis of the heatmap, defaults to the first parameter of the space")
+	yFlag := flag.String("y", "", "Parameter on the y axis of the heatmap, defaults to the second parameter of the space")
+	objectiveFlag := flag.String("objective", "net-pnl", "Score of a combo, averaged over its runs: "+strings.Join(runner.ObjectiveNames(), ", "))
+	minTrades := flag.Int("min-trades", 0, "Leave out combos with a run of fewer trades")
+	aggregateFlag := flag.String("aggregate", "mean", "How scores are aggregated over the other parameters: mean, median or max")
+	output := flag.String("output", "output/sensitivity", "Directory of the PNG files")
+	flag.Parse()
+
+	objectives, err := runner.ParseObjectives(*objectiveFlag, *minTrades)
+	if err != nil {
+		panic(err)
+	}
+	if len(objectives) != 1 {
+		panic("sensitivity is plotted for a single objective")
+	}
+
+	aggregate, ok := reports.Aggregates[*aggregateFlag]
+	if !ok {
+		panic(fmt.Sprintf("unknown aggregate '%s'", *aggregateFlag))
+	}
+
+	space := strategies.BreakoutSpace
+	schema := space.Schema()
+	if *xFlag == "" && len(schema) > 0 {
+		*xFlag = schema[0].Name
+	}
+	if *yFlag == "" && len(schema) > 1 {
+		*yFlag = schema[1].Name
+	}
+
+	store, err := runner.OpenStore(*storeFlag)
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+
+	options := &reports.SweepOptions{Instrument: *instrument, BrokerConfig: *brokerFlag}
+	if *rangesFlag != "" {
+		for _, s := range strings.Split(*rangesFlag, ",") {
+			timeRange, err := common.ParseTimeRange(strings.TrimSpace(s))
+			if err != nil {
+				panic(err)
+			}
+			options.TimeRanges = append(options.TimeRanges, timeRange)
+		}
+	}
+
+	sweep, err := reports.LoadSweep(store, space, objectives[0], options)
+	if err != nil {
+		panic(err)
+	}
+	if len(sweep.Combos) == 0 {
+		fmt.Println("No run of the parameter space found, run a gridsearch first")
+		return
+	}
+
+	best, bestScore := sweep.Best()
+	fmt.Printf("Found %d combos, best %s %.4f: %v\n", len(sweep.Combos), *objectiveFlag, bestScore, best)
+
+	if err := os.MkdirAll(*output, 0755); err != nil {
+		panic(err)
+	}
+	label := fmt.Sprintf("%s %s", *aggregateFlag, *objectiveFlag)
+
+	heatmap, err := sweep.Heatmap(*xFlag, *yFlag, aggregate)
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(*output, fmt.Sprintf("heatmap_%s_%s.png", *xFlag, *yFlag))
+	if err := reports.PlotHeatmap(heatmap, fmt.Sprintf("%s by %s and %s", label, *xFlag, *yFlag), *objectiveFlag, best, path); err != nil {
+		panic(err)
+	}
+	fmt.Printf("Heatmap saved to %s\n", path)
+
+	fmt.Printf("\n📈 Sensitivity (%s)\n", label)
+	fmt.Printf("=================\n")
+	for _, parameter := range schema {
+		curve, err := sweep.Curve(parameter.Name, aggregate)
+		if err != nil {
+			panic(err)
+		}
+
+		path := filepath.Join(*output, fmt.Sprintf("curve_%s.png", parameter.Name))
+		if err := reports.PlotCurve(curve, fmt.Sprintf("%s by %s", label, parameter.Name), *objectiveFlag, best, path); err != nil {
+			panic(err)
+		}
+
+		points := make([]string, len(curve.Values))
+		for i, value := range curve.Values {
+			points[i] = fmt.Sprintf("%v: %.2f", value, curve.Scores[i])
+		}
+		fmt.Printf("📊 %s (best %v): %s\n", parameter.Name, best[parameter.Name], strings.Join(points, ", "))
+	}
+	fmt.Printf("\nCurves saved to %s\n", *output)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/gridsearch"
+	"go-experiments/runner"
+	"go-experiments/strategies"
+	"go-experiments/traders"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func main() {
+	instrument := "EURUSD"
+
+	rangeFlag := flag.String("range", "2023-01..2023-12", "Months to walk forward through, e.g. 2023-01..2023-12")
+	inSample := flag.Int("in-sample", 6, "Number of months on which combos are optimised in each window")
+	outOfSample := flag.Int("out-of-sample", 1, "Number of months on which the best combo is tested in each window, and by which windows move forward")
+	anchored := flag.Bool("anchored", false, "Optimise from the beginning of the range in each window, instead of on the last in-sample months only")
+	storeFlag := flag.String("store", "", "Results store: sqlite:<path>, csv:<dir> or memory, defaults to output/data.db")
+	workers := flag.Int("workers", 0, "Number of concurrent runs, defaults to the number of CPU cores")
+	retryFailed := flag.Bool("retry-failed", false, "Run again runs which failed previously (succeeded runs are always skipped, so an interrupted walk can be resumed)")
+	cacheMB := flag.Int64("cache-mb", 0, "Memory budget of the dataset cache in MB, defaults to 4096")
+	searchFlag := flag.String("search", "random", "Search strategy of each window: "+strings.Join(gridsearch.SearchNames, ", ")+" (lhs for Latin hypercube, tpe for Bayesian)")
+	budget := flag.Int("budget", 200, "Number of combos to run in each window with random, lhs and tpe searches, 0 for all combos")
+	seed := flag.Int64("seed", 1, "Seed of random, lhs, tpe and genetic searches")
+	batchSize := flag.Int("batch", 32, "Number of combos proposed at a time by the tpe search")
+	population := flag.Int("population", 50, "Genetic search: number of combos per generation")
+	generations := flag.Int("generations", 20, "Genetic search: number of generations")
+	objectiveFlag := flag.String("objective", "net-pnl", "Comma separated objectives of a combo on an in-sample period, the best combo being the best on the first one among the Pareto front: "+strings.Join(runner.ObjectiveNames(), ", "))
+	minTrades := flag.Int("min-trades", 0, "In-sample runs with fewer trades score worst on every objective")
+	candles := flag.Bool("candles", false, "Drive the backtests from precomputed M1 candles instead of ticks, much faster for sweeps")
+	intrabar := flag.String("intrabar", backtesting.IntrabarWorstCase.String(), "Candle mode: resolution when a candle touches both stop loss and take profit (worst-case, ohlc-path, tick-drilldown)")
+	flag.Parse()
+
+	timeRange, err := common.ParseTimeRange(*rangeFlag)
+	if err != nil {
+		panic(err)
+	}
+	windows, err := runner.WalkForwardWindows(timeRange, *inSample, *outOfSample, *anchored)
+	if err != nil {
+		panic(err)
+	}
+
+	objectives, err := runner.ParseObjectives(*objectiveFlag, *minTrades)
+	if err != nil {
+		panic(err)
+	}
+
+	intrabarResolution, err := backtesting.ParseIntrabarResolution(*intrabar)
+	if err != nil {
+		panic(err)
+	}
+
+	space := strategies.BreakoutSpace
+	if err := space.ValidateBuild(func(combo gridsearch.Combo) { strategies.BreakoutBuilder(combo) }); err != nil {
+		panic(err)
+	}
+
+	searchOptions := &gridsearch.SearchOptions{Budget: *budget, Seed: *seed, Population: *population, Generations: *generations}
+	if _, err := gridsearch.NewSearch(*searchFlag, space, searchOptions); err != nil {
+		panic(err) // Fails early on an unknown strategy
+	}
+	newSearch := func(window runner.WalkForwardWindow) gridsearch.SearchStrategy {
+		search, _ := gridsearch.NewSearch(*searchFlag, space, searchOptions)
+		return search
+	}
+
+	batch := 0
+	if *searchFlag == "tpe" {
+		batch = max(1, *batchSize)
+	}
+
+	store, err := runner.OpenStore(*storeFlag)
+	if err != nil {
+		panic(err)
+	}
+
+	// On interrupt, pending runs are skipped and running ones complete
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	r, err := runner.NewRunnerWithOptions(ctx, &runner.Options{
+		Store:       store,
+		CacheBudget: *cacheMB << 20,
+		RetryFailed: *retryFailed,
+		Pool:        runner.PoolOptions{Workers: *workers},
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer r.Close()
+
+	brokerConfig := runner.DefaultBrokerConfig()
+	brokerConfig.Candles, brokerConfig.Intrabar = *candles, intrabarResolution
+
+	fmt.Printf("Walking forward through %d windows (%s search)\n", len(windows), *searchFlag)
+
+	result, err := r.WalkForward(&runner.WalkForwardOptions{
+		Windows: windows,
+		Search:  newSearch,
+		Batch:   batch,
+		Spec: func(combo gridsearch.Combo, timeRange common.TimeRange) *runner.RunSpec {
+			return &runner.RunSpec{
+				Instrument: instrument,
+				TimeRange:  timeRange,
+				Trader:     traders.ModularSpec(strategies.BreakoutBuilder(combo)),
+				Broker:     brokerConfig,
+				Params:     combo,
+			}
+		},
+		Objectives: objectives,
+	})
+	if err != nil {
+		fmt.Printf("Stopped walking forward: %v\n", err)
+	}
+
+	fmt.Printf("\n🚶 Windows\n")
+	fmt.Printf("==========\n")
+	for _, window := range result.Windows {
+		if window.InSample == nil || window.OutOfSample == nil {
+			fmt.Printf("❌ %s: no result\n", window)
+			continue
+		}
+		fmt.Printf("📊 %s: in-sample %s, PnL %.2f -> out-of-sample PnL %.2f (%d trades), efficiency %s\n",
+			window, runner.FormatScores(*objectiveFlag, window.Scores), window.InSample.NetPnL, window.OutOfSample.NetPnL, window.OutOfSample.TotalTrades, formatRatio(window.Efficiency))
+		fmt.Printf("   Best combo: %v\n", window.Best)
+	}
+
+	fmt.Printf("\n📈 Out-of-sample equity\n")
+	fmt.Printf("=======================\n")
+	for _, point := range result.Equity {
+		fmt.Printf("%s: %10.2f %10.2f\n", point.Month, point.PnL, point.Equity)
+	}
+
+	fmt.Printf("\nWalk-forward efficiency: %s\n", formatRatio(result.Efficiency))
+}
+
+func formatRatio(ratio float64) string {
+	if math.IsNaN(ratio) {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.0f%%", ratio*100)
+}
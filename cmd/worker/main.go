@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go-experiments/runner"
+	"os"
+	"os/signal"
+)
+
+// Runs backtests served by a gridsearch in coordinator mode, e.g.:
+//
+//	go run ./cmd/gridsearch -serve :8080
+//	go run ./cmd/worker -coordinator http://localhost:8080
+func main() {
+	coordinator := flag.String("coordinator", "http://localhost:8080", "Base URL of the coordinator")
+	workers := flag.Int("workers", 0, "Number of concurrent runs, defaults to the number of CPU cores")
+	cacheMB := flag.Int64("cache-mb", 0, "Memory budget of the dataset cache in MB, defaults to 4096")
+	flag.Parse()
+
+	// On interrupt, runs in progress are abandoned and handed out again by the coordinator
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	worker := runner.NewWorker(*coordinator, runner.HistoricalLoader, *cacheMB<<20)
+
+	fmt.Printf("Pulling runs from %s\n", *coordinator)
+	worker.Run(ctx, *workers)
+}
@@ -239,3 +239,39 @@ var (
 		return NewSession("New York", 9, 0, 17, 0, loc)
 	}()
 )
+
+var fxMarketLocation = func() *time.Location {
+	loc, _ := time.LoadLocation("America/New_York")
+	return loc
+}()
+
+// IsFXHoliday checks whether the given trading day is a day where the FX market is closed globally.
+// Liquidity providers stop quoting on these days, so no data is expected.
+//
+// List of holidays covered:
+// - New Year's Day: January 1
+// - Christmas Day: December 25
+func IsFXHoliday(date time.Time) bool {
+	month := date.Month()
+	day := date.Day()
+
+	return (month == time.January && day == 1) || (month == time.December && day == 25)
+}
+
+// IsFXMarketOpen returns true if the FX market is open at the given time.
+//
+// The FX market follows a weekly schedule based on New York time:
+// it opens on Sunday at 17:00 and closes on Friday at 17:00.
+// A trading day starts at 17:00 New York time on the previous calendar day,
+// so holidays close the market from 17:00 on the eve to 17:00 on the holiday itself.
+func IsFXMarketOpen(t time.Time) bool {
+	// Shift so that the trading day starting at 17:00 maps to its calendar date
+	tradingDay := t.In(fxMarketLocation).Add(7 * time.Hour)
+
+	switch tradingDay.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+
+	return !IsFXHoliday(tradingDay)
+}
@@ -37,3 +37,22 @@ func (m Month) FirstDay() time.Time {
 func (m Month) LastDay() time.Time {
 	return time.Date(m.year, time.Month(m.month), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, -1)
 }
+
+// AddMonths returns the month n months later (or earlier if n is negative).
+func (m Month) AddMonths(n int) Month {
+	return FromDate(m.FirstDay().AddDate(0, n, 0))
+}
+
+// Before returns true if m is before other.
+func (m Month) Before(other Month) bool {
+	return m.year < other.year || (m.year == other.year && m.month < other.month)
+}
+
+// ParseMonth parses a month formatted as "2025-01".
+func ParseMonth(s string) (Month, error) {
+	t, err := time.Parse("2006-01", s)
+	if err != nil {
+		return Month{}, fmt.Errorf("invalid month '%s': %w", s, err)
+	}
+	return FromDate(t), nil
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeRange is a period of time, from begin (inclusive) to end (exclusive).
+type TimeRange struct {
+	begin time.Time
+	end   time.Time
+}
+
+func NewTimeRange(begin, end time.Time) TimeRange {
+	return TimeRange{begin: begin.UTC(), end: end.UTC()}
+}
+
+// MonthRange covers whole months, from begin to end (both inclusive).
+func MonthRange(begin, end Month) TimeRange {
+	return NewTimeRange(begin.FirstDay(), end.FirstDay().AddDate(0, 1, 0))
+}
+
+// QuarterRange covers a quarter (1 to 4) of a year.
+func QuarterRange(year int, quarter int) TimeRange {
+	first := NewMonth(year, (quarter-1)*3+1)
+	return MonthRange(first, first.AddMonths(2))
+}
+
+// YearRange covers a whole year.
+func YearRange(year int) TimeRange {
+	return MonthRange(NewMonth(year, 1), NewMonth(year, 12))
+}
+
+func (r TimeRange) Begin() time.Time {
+	return r.begin
+}
+
+func (r TimeRange) End() time.Time {
+	return r.end
+}
+
+func (r TimeRange) Contains(t time.Time) bool {
+	return !t.Before(r.begin) && t.Before(r.end)
+}
+
+// IsMonthAligned returns true if the range covers whole months only.
+func (r TimeRange) IsMonthAligned() bool {
+	return r.begin.Equal(FromDate(r.begin).FirstDay()) && r.end.Equal(FromDate(r.end).FirstDay())
+}
+
+// Months returns all the months the range overlaps, in chronological order.
+func (r TimeRange) Months() []Month {
+	months := make([]Month, 0)
+	for m := FromDate(r.begin); m.FirstDay().Before(r.end); m = m.AddMonths(1) {
+		months = append(months, m)
+	}
+	return months
+}
+
+// String formats the range so that it can be parsed back by ParseTimeRange:
+// - "2025-01" for a single month
+// - "2025-01..2025-03" for whole months (both inclusive)
+// - "2025-01-06..2025-01-10" for whole days (both inclusive)
+// - RFC3339 timestamps separated by ".." otherwise (end exclusive)
+func (r TimeRange) String() string {
+	if r.IsMonthAligned() {
+		first := FromDate(r.begin)
+		last := FromDate(r.end).AddMonths(-1)
+		if first == last {
+			return first.String()
+		}
+		return first.String() + ".." + last.String()
+	}
+
+	if isDayAligned(r.begin) && isDayAligned(r.end) {
+		return r.begin.Format(time.DateOnly) + ".." + r.end.AddDate(0, 0, -1).Format(time.DateOnly)
+	}
+
+	return r.begin.Format(time.RFC3339) + ".." + r.end.Format(time.RFC3339)
+}
+
+func isDayAligned(t time.Time) bool {
+	return t.Equal(t.Truncate(24 * time.Hour))
+}
+
+// ParseTimeRange parses a range formatted by TimeRange.String.
+func ParseTimeRange(s string) (TimeRange, error) {
+	beginStr, endStr, isRange := strings.Cut(s, "..")
+	if !isRange {
+		endStr = beginStr
+	}
+
+	if begin, err := ParseMonth(beginStr); err == nil {
+		end, err := ParseMonth(endStr)
+		if err != nil {
+			return TimeRange{}, fmt.Errorf("invalid time range '%s': %w", s, err)
+		}
+		return MonthRange(begin, end), nil
+	}
+
+	if begin, err := time.Parse(time.DateOnly, beginStr); err == nil {
+		end, err := time.Parse(time.DateOnly, endStr)
+		if err != nil {
+			return TimeRange{}, fmt.Errorf("invalid time range '%s': %w", s, err)
+		}
+		return NewTimeRange(begin, end.AddDate(0, 0, 1)), nil
+	}
+
+	begin, err := time.Parse(time.RFC3339, beginStr)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("invalid time range '%s': %w", s, err)
+	}
+	end, err := time.Parse(time.RFC3339, endStr)
+	if err != nil || !isRange {
+		return TimeRange{}, fmt.Errorf("invalid time range '%s': expected begin..end", s)
+	}
+
+	return NewTimeRange(begin, end), nil
+}
@@ -0,0 +1,215 @@
+package gridsearch
+
+import (
+	"go-experiments/common"
+	"math"
+	"sort"
+)
+
+var log = common.NewLogger("gridsearch")
+
+type GeneticOptions struct {
+	Population  int     // Number of individuals per generation (default 50)
+	Generations int     // Number of generations, including the initial random one (default 20)
+	Elite       int     // Number of best individuals copied unchanged to the next generation (default 2, negative for none)
+	Crossover   float64 // Probability that a child mixes the parameters of both parents (default 0.9)
+	Mutation    float64 // Probability that each parameter of a child is mutated (default 1 / number of parameters)
+	Tournament  int     // Number of individuals competing to be selected as a parent (default 3)
+	Seed        int64   // Seed of the random generator, searches with the same seed and observations are identical
+}
+
+// Genetic evolves a population of combos: parents are selected by tournament, crossed over and mutated,
+// and the best individuals of each generation are kept unchanged.
+//
+// Each distinct combo is proposed once, individuals seen in earlier generations keep their fitness.
+// Since the search is deterministic for a seed, running it again against the same results store
+// proposes the same combos, whose results are found in the store instead of being run again.
+func Genetic(space *ParameterSpace, options *GeneticOptions) SearchStrategy {
+	g := &genetic{
+		sampler:     newSampler(space, 0, options.Seed),
+		population:  options.Population,
+		generations: options.Generations,
+		elite:       options.Elite,
+		crossover:   options.Crossover,
+		mutation:    options.Mutation,
+		tournament:  options.Tournament,
+		fitness:     make(map[string]float64),
+	}
+	if g.population <= 0 {
+		g.population = 50
+	}
+	if g.generations <= 0 {
+		g.generations = 20
+	}
+	if g.elite < 0 || g.elite > g.population {
+		g.elite = 0
+	} else if g.elite == 0 {
+		g.elite = min(2, g.population)
+	}
+	if g.crossover <= 0 {
+		g.crossover = 0.9
+	}
+	if g.mutation <= 0 {
+		g.mutation = 1 / float64(max(1, len(space.parameters)))
+	}
+	if g.tournament <= 0 {
+		g.tournament = 3
+	}
+	return g
+}
+
+type genetic struct {
+	*sampler
+	population  int
+	generations int
+	elite       int
+	crossover   float64
+	mutation    float64
+	tournament  int
+
+	generation  int     // Index of the current generation, the initial random one being 0
+	individuals [][]int // Current generation
+	pending     [][]int // Individuals of the current generation not proposed yet
+	fitness     map[string]float64
+}
+
+func (g *genetic) Propose(n int) []Combo {
+	for len(g.pending) == 0 {
+		if !g.nextGeneration() {
+			return []Combo{}
+		}
+	}
+
+	count := len(g.pending)
+	if n > 0 && n < count {
+		count = n
+	}
+
+	combos := make([]Combo, 0, count)
+	for _, indices := range g.pending[:count] {
+		combos = append(combos, g.combo(indices))
+	}
+	g.pending = g.pending[count:]
+
+	return combos
+}
+
+func (g *genetic) Observe(combo Combo, score float64) {
+	indices, ok := g.indices(combo)
+	if !ok {
+		return
+	}
+	if math.IsNaN(score) {
+		score = math.Inf(-1)
+	}
+	g.fitness[indicesKey(indices)] = score
+}
+
+// nextGeneration creates the next generation and the individuals to propose, false once the search is over.
+func (g *genetic) nextGeneration() bool {
+	if g.individuals == nil {
+		g.individuals = make([][]int, 0, g.population)
+		for len(g.individuals) < g.population {
+			indices := g.random()
+			if indices == nil {
+				break // Space smaller than the population
+			}
+			g.individuals = append(g.individuals, indices)
+		}
+		g.pending = append([][]int(nil), g.individuals...)
+		return len(g.pending) > 0
+	}
+
+	if g.generation+1 >= g.generations {
+		return false
+	}
+	g.generation++
+
+	g.sortByFitness()
+	log.Info("🧬 Generation %d: best fitness %.4f", g.generation, g.fitnessOf(g.individuals[0]))
+
+	next := make([][]int, 0, g.population)
+	for _, individual := range g.individuals[:g.elite] {
+		next = append(next, individual)
+	}
+	for len(next) < g.population {
+		child := g.breed(g.selectParent(), g.selectParent())
+
+		if !g.space.valid(child) {
+			// Replace children violating constraints by random combos
+			if child = g.random(); child == nil {
+				break // All combos were proposed
+			}
+			g.pending = append(g.pending, child)
+		} else if g.add(child) {
+			// Combos already run keep their fitness, and are proposed only once
+			g.pending = append(g.pending, child)
+		}
+
+		next = append(next, child)
+	}
+	g.individuals = next
+
+	return true
+}
+
+// fitnessOf returns the observed fitness of the individual, the worst one if it was not observed (e.g. failed runs).
+func (g *genetic) fitnessOf(individual []int) float64 {
+	fitness, ok := g.fitness[indicesKey(individual)]
+	if !ok {
+		return math.Inf(-1)
+	}
+	return fitness
+}
+
+func (g *genetic) sortByFitness() {
+	sort.SliceStable(g.individuals, func(i, j int) bool {
+		return g.fitnessOf(g.individuals[i]) > g.fitnessOf(g.individuals[j])
+	})
+}
+
+// selectParent returns the fittest of randomly drawn individuals.
+func (g *genetic) selectParent() []int {
+	best := g.individuals[g.rand.Intn(len(g.individuals))]
+	for i := 1; i < g.tournament; i++ {
+		candidate := g.individuals[g.rand.Intn(len(g.individuals))]
+		if g.fitnessOf(candidate) > g.fitnessOf(best) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// breed applies uniform crossover and mutation: numeric parameters move to nearby values, other ones to any value.
+func (g *genetic) breed(a, b []int) []int {
+	child := append([]int(nil), a...)
+
+	if g.rand.Float64() < g.crossover {
+		for d := range child {
+			if g.rand.Intn(2) == 0 {
+				child[d] = b[d]
+			}
+		}
+	}
+
+	for d, p := range g.space.parameters {
+		count := len(p.values)
+		if count < 2 || g.rand.Float64() >= g.mutation {
+			continue
+		}
+
+		if p.schema.Type.numeric() {
+			step := 1 + g.rand.Intn(max(1, count/4))
+			if g.rand.Intn(2) == 0 {
+				step = -step
+			}
+			child[d] = min(max(child[d]+step, 0), count-1)
+		} else {
+			// Any other value
+			child[d] = (child[d] + 1 + g.rand.Intn(count-1)) % count
+		}
+	}
+
+	g.space.normalize(child)
+	return child
+}
@@ -0,0 +1,77 @@
+package gridsearch
+
+import (
+	"math"
+	"sort"
+)
+
+// Dominates returns true if scores a are at least as good as b on every objective, and better on one (higher is better).
+func Dominates(a, b []float64) bool {
+	better := false
+	for i := range a {
+		if worse(a[i], b[i]) {
+			return false
+		}
+		if worse(b[i], a[i]) {
+			better = true
+		}
+	}
+	return better
+}
+
+// worse compares scores, NaN being the worst.
+func worse(a, b float64) bool {
+	if math.IsNaN(a) {
+		return !math.IsNaN(b)
+	}
+	return a < b
+}
+
+// ParetoRanks returns the Pareto front of each score vector, higher being better on every objective:
+// 0 for the vectors which no other one dominates, 1 for those dominated only by front 0, and so on.
+func ParetoRanks(scores [][]float64) []int {
+	// Sorted best first on the first objective (then on the next ones), a vector can only be dominated by earlier ones
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := scores[order[i]], scores[order[j]]
+		for d := range a {
+			if worse(b[d], a[d]) {
+				return true
+			}
+			if worse(a[d], b[d]) {
+				return false
+			}
+		}
+		return false
+	})
+
+	ranks := make([]int, len(scores))
+	fronts := make([][]int, 0)
+	for _, i := range order {
+		rank := 0
+		for ; rank < len(fronts); rank++ {
+			if !dominatedBy(scores[i], scores, fronts[rank]) {
+				break
+			}
+		}
+		if rank == len(fronts) {
+			fronts = append(fronts, nil)
+		}
+		fronts[rank] = append(fronts[rank], i)
+		ranks[i] = rank
+	}
+
+	return ranks
+}
+
+func dominatedBy(score []float64, scores [][]float64, front []int) bool {
+	for _, j := range front {
+		if Dominates(scores[j], score) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package gridsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+type ParameterType int
+
+const (
+	ParameterInt ParameterType = iota
+	ParameterFloat
+	ParameterBool
+	ParameterString
+)
+
+func (t ParameterType) String() string {
+	switch t {
+	case ParameterInt:
+		return "int"
+	case ParameterFloat:
+		return "float"
+	case ParameterBool:
+		return "bool"
+	case ParameterString:
+		return "string"
+	default:
+		return "unknown"
+	}
+}
+
+func (t ParameterType) numeric() bool {
+	return t == ParameterInt || t == ParameterFloat
+}
+
+// ParameterSchema declares a parameter, so that values and combos can be validated before running anything.
+type ParameterSchema struct {
+	Name     string
+	Type     ParameterType
+	Min, Max float64 // Inclusive bounds of numeric values, unchecked if Max <= Min
+}
+
+func (s *ParameterSchema) bounded() bool {
+	return s.Type.numeric() && s.Max > s.Min
+}
+
+// convert returns the value with the type of the parameter, and checks its bounds.
+func (s *ParameterSchema) convert(value interface{}) (interface{}, error) {
+	converted, err := convertValue(s.Type, value)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %s: %w", s.Name, err)
+	}
+
+	if s.bounded() {
+		f, _ := convertValue(ParameterFloat, converted)
+		if f.(float64) < s.Min || f.(float64) > s.Max {
+			return nil, fmt.Errorf("parameter %s: %v out of bounds [%v, %v]", s.Name, value, s.Min, s.Max)
+		}
+	}
+
+	return converted, nil
+}
+
+// inferSchema returns the schema matching all values: ints are promoted to floats if mixed with floats.
+func inferSchema(name string, values []interface{}) (ParameterSchema, error) {
+	counts := make(map[ParameterType]int)
+	for _, value := range values {
+		switch value.(type) {
+		case int:
+			counts[ParameterInt]++
+		case float64:
+			counts[ParameterFloat]++
+		case bool:
+			counts[ParameterBool]++
+		case string:
+			counts[ParameterString]++
+		default:
+			return ParameterSchema{}, fmt.Errorf("parameter %s: unsupported value %v of type %T", name, value, value)
+		}
+	}
+
+	switch {
+	case counts[ParameterInt] == len(values):
+		return ParameterSchema{Name: name, Type: ParameterInt}, nil
+	case counts[ParameterInt]+counts[ParameterFloat] == len(values):
+		return ParameterSchema{Name: name, Type: ParameterFloat}, nil
+	case counts[ParameterBool] == len(values):
+		return ParameterSchema{Name: name, Type: ParameterBool}, nil
+	case counts[ParameterString] == len(values):
+		return ParameterSchema{Name: name, Type: ParameterString}, nil
+	default:
+		return ParameterSchema{}, fmt.Errorf("parameter %s: mixed value types %v", name, values)
+	}
+}
+
+// convertValue converts numbers leniently: floats without fractional part to ints, ints to floats,
+// and numbers decoded from JSON.
+func convertValue(t ParameterType, value interface{}) (interface{}, error) {
+	if number, ok := value.(json.Number); ok {
+		f, err := number.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", number)
+		}
+		value = f
+	}
+
+	switch t {
+	case ParameterInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int32:
+			return int(v), nil
+		case int64:
+			return int(v), nil
+		case float32:
+			return convertValue(t, float64(v))
+		case float64:
+			if v != math.Trunc(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%v is not an integer", v)
+			}
+			return int(v), nil
+		}
+
+	case ParameterFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+
+	case ParameterBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+
+	case ParameterString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v of type %T is not a %s", value, value, t)
+}
+
+// Schema returns the declared parameters, sorted by name.
+func (space *ParameterSpace) Schema() []ParameterSchema {
+	schemas := make([]ParameterSchema, len(space.parameters))
+	for i, p := range space.parameters {
+		schemas[i] = p.schema
+	}
+	return schemas
+}
+
+// Validate reports invalid declarations, and conditions or constraints which fail to evaluate on a combo
+// (e.g. reading a parameter which is not declared), before anything is run.
+func (space *ParameterSpace) Validate() error {
+	errs := append([]error(nil), space.errs...)
+
+	combo := space.combo(make([]int, len(space.parameters)))
+	check := func(kind string, predicate func(Combo) bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				errs = append(errs, fmt.Errorf("%s failed on %v: %v", kind, combo, r))
+			}
+		}()
+		predicate(combo)
+	}
+
+	for _, p := range space.parameters {
+		if p.condition != nil {
+			check("condition of parameter "+p.schema.Name, p.condition)
+		}
+	}
+	for i, predicate := range space.constraints {
+		check(fmt.Sprintf("constraint %d", i+1), predicate)
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateBuild validates the space, and checks that build (e.g. of the strategy) does not panic on its first combo.
+func (space *ParameterSpace) ValidateBuild(build func(Combo)) (err error) {
+	if err := space.Validate(); err != nil {
+		return fmt.Errorf("invalid parameter space: %w", err)
+	}
+
+	size := space.Size()
+	if size == 0 {
+		return fmt.Errorf("no valid combo in parameter space")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to build strategy from parameter space: %v", r)
+		}
+	}()
+	build(space.GenerateShard(0, size)[0]) // The first combo only
+
+	return nil
+}
+
+// Convert returns the combo with values converted to the declared types, e.g. after parsing it from JSON.
+// Values must be within bounds but not necessarily among the declared values, so that combos of an earlier
+// version of the space are accepted.
+func (space *ParameterSpace) Convert(combo Combo) (Combo, error) {
+	converted := make(Combo, len(combo))
+	var errs []error
+
+	for _, p := range space.parameters {
+		value, ok := combo[p.schema.Name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("parameter %s: missing", p.schema.Name))
+			continue
+		}
+
+		value, err := p.schema.convert(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		converted[p.schema.Name] = value
+	}
+
+	unknown := make([]string, 0)
+	for name := range combo {
+		if !space.declared(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		errs = append(errs, fmt.Errorf("unknown parameters %v", unknown))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return converted, nil
+}
+
+// ParseCombo parses a combo serialised with ComboToJSON, and converts it to the declared types.
+func (space *ParameterSpace) ParseCombo(data []byte) (Combo, error) {
+	combo, err := ComboFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return space.Convert(combo)
+}
+
+func (space *ParameterSpace) declared(name string) bool {
+	for _, p := range space.parameters {
+		if p.schema.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ComboToJSON serialises the combo as a JSON object, with sorted keys.
+func ComboToJSON(combo Combo) string {
+	data, err := json.Marshal(combo)
+	if err != nil {
+		panic(fmt.Sprintf("failed to serialise combo %v: %v", combo, err))
+	}
+	return string(data)
+}
+
+// ComboFromJSON parses a combo serialised with ComboToJSON. Numbers are kept as json.Number, and converted
+// by accessors, see ParameterSpace.ParseCombo to convert them to the declared types up front.
+func ComboFromJSON(data []byte) (Combo, error) {
+	var combo Combo
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&combo); err != nil {
+		return nil, fmt.Errorf("invalid combo: %w", err)
+	}
+
+	return combo, nil
+}
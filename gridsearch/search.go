@@ -0,0 +1,428 @@
+package gridsearch
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// SearchStrategy proposes the combos to run, possibly guided by the scores of completed ones.
+type SearchStrategy interface {
+	// Propose returns up to n new combos (as many as the budget allows if n <= 0), none once the budget is spent.
+	Propose(n int) []Combo
+
+	// Observe reports the score of a proposed combo, higher is better. Observing a combo again replaces its score,
+	// e.g. when combos are ranked against each other.
+	Observe(combo Combo, score float64)
+}
+
+// SearchOptions configure the strategies created by NewSearch, each one using its own options.
+type SearchOptions struct {
+	Budget int   // Random, lhs and tpe searches: number of combos, 0 for all combos
+	Seed   int64 // Random, lhs, tpe and genetic searches
+
+	// Grid search: 0-based index and count of the shard to propose, see ParameterSpace.GenerateShard (0 for all combos)
+	Shard, Shards int
+
+	Population, Generations int // Genetic search, see GeneticOptions
+}
+
+// SearchNames are the names of the strategies created by NewSearch.
+var SearchNames = []string{"grid", "random", "lhs", "tpe", "genetic"}
+
+// NewSearch creates a search strategy by name: grid, random, lhs (Latin hypercube), tpe (Bayesian) or genetic.
+func NewSearch(name string, space *ParameterSpace, options *SearchOptions) (SearchStrategy, error) {
+	switch name {
+	case "grid":
+		if options.Shards == 0 {
+			return GridSearch(space), nil
+		}
+		return GridSearchShard(space, options.Shard, options.Shards), nil
+	case "random":
+		return RandomSearch(space, options.Budget, options.Seed), nil
+	case "lhs":
+		return LatinHypercube(space, options.Budget, options.Seed), nil
+	case "tpe":
+		return TPE(space, &TPEOptions{Budget: options.Budget, Seed: options.Seed}), nil
+	case "genetic":
+		return Genetic(space, &GeneticOptions{Population: options.Population, Generations: options.Generations, Seed: options.Seed}), nil
+	default:
+		return nil, fmt.Errorf("unknown search strategy '%s', expected one of %s", name, strings.Join(SearchNames, ", "))
+	}
+}
+
+// sampler keeps track of the combos proposed by a strategy, as indices of values in each parameter.
+type sampler struct {
+	space    *ParameterSpace
+	budget   int
+	proposed map[string]bool
+	rand     *rand.Rand
+}
+
+func newSampler(space *ParameterSpace, budget int, seed int64) *sampler {
+	size := space.Size()
+	if budget <= 0 || budget > size {
+		budget = size
+	}
+
+	return &sampler{
+		space:    space,
+		budget:   budget,
+		proposed: make(map[string]bool),
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// remaining returns how many combos can still be proposed, out of n.
+func (s *sampler) remaining(n int) int {
+	left := s.budget - len(s.proposed)
+	if n <= 0 || n > left {
+		return left
+	}
+	return n
+}
+
+// add records the combo, returning false if it was already proposed.
+func (s *sampler) add(indices []int) bool {
+	key := indicesKey(indices)
+	if s.proposed[key] {
+		return false
+	}
+	s.proposed[key] = true
+	return true
+}
+
+func (s *sampler) combo(indices []int) Combo {
+	return s.space.combo(indices)
+}
+
+func (s *sampler) indices(combo Combo) ([]int, bool) {
+	return s.space.indices(combo)
+}
+
+// random proposes a valid combo not proposed yet drawn uniformly, nil if all were proposed.
+func (s *sampler) random() []int {
+	parameters := s.space.parameters
+	for attempt := 0; attempt < 100; attempt++ {
+		indices := make([]int, len(parameters))
+		for d, p := range parameters {
+			indices[d] = s.rand.Intn(len(p.values))
+		}
+		s.space.normalize(indices)
+		if s.space.valid(indices) && s.add(indices) {
+			return indices
+		}
+	}
+
+	// Nearly exhausted or heavily constrained space: pick among the combos left
+	left := make([][]int, 0)
+	s.space.enumerate(func(indices []int) {
+		if !s.proposed[indicesKey(indices)] {
+			left = append(left, append([]int(nil), indices...))
+		}
+	})
+	if len(left) == 0 {
+		return nil
+	}
+
+	indices := left[s.rand.Intn(len(left))]
+	s.add(indices)
+	return indices
+}
+
+func indicesKey(indices []int) string {
+	parts := make([]string, len(indices))
+	for i, index := range indices {
+		parts[i] = fmt.Sprint(index)
+	}
+	return strings.Join(parts, ",")
+}
+
+// GridSearch proposes all combos of the space, in their stable order.
+func GridSearch(space *ParameterSpace) SearchStrategy {
+	return GridSearchShard(space, 0, 1)
+}
+
+// GridSearchShard proposes the combos of a shard of the space, see ParameterSpace.GenerateShard.
+func GridSearchShard(space *ParameterSpace, index, count int) SearchStrategy {
+	return &gridSearch{combos: space.GenerateShard(index, count)}
+}
+
+type gridSearch struct {
+	combos []Combo // Combos not proposed yet
+}
+
+func (g *gridSearch) Propose(n int) []Combo {
+	if n <= 0 || n > len(g.combos) {
+		n = len(g.combos)
+	}
+
+	combos := g.combos[:n]
+	g.combos = g.combos[n:]
+	return combos
+}
+
+func (g *gridSearch) Observe(combo Combo, score float64) {}
+
+// RandomSearch proposes budget distinct combos drawn uniformly (all combos if budget is 0 or exceeds the space size).
+func RandomSearch(space *ParameterSpace, budget int, seed int64) SearchStrategy {
+	return &randomSearch{sampler: newSampler(space, budget, seed)}
+}
+
+type randomSearch struct {
+	*sampler
+}
+
+func (r *randomSearch) Propose(n int) []Combo {
+	combos := make([]Combo, 0)
+	for i := r.remaining(n); i > 0; i-- {
+		indices := r.random()
+		if indices == nil {
+			break
+		}
+		combos = append(combos, r.combo(indices))
+	}
+	return combos
+}
+
+func (r *randomSearch) Observe(combo Combo, score float64) {}
+
+// LatinHypercube proposes budget combos which cover the range of each parameter evenly:
+// each parameter range is split in budget strata, and each stratum is used by exactly one combo.
+// Combos which collide once mapped to the discrete values, or violate constraints, are replaced by random ones.
+func LatinHypercube(space *ParameterSpace, budget int, seed int64) SearchStrategy {
+	s := newSampler(space, budget, seed)
+
+	parameters := space.parameters
+
+	// Stratum of each combo in each parameter
+	strata := make([][]int, len(parameters))
+	for d := range parameters {
+		strata[d] = s.rand.Perm(s.budget)
+	}
+
+	points := make([][]int, s.budget)
+	for i := range points {
+		points[i] = make([]int, len(parameters))
+		for d, p := range parameters {
+			position := (float64(strata[d][i]) + s.rand.Float64()) / float64(s.budget)
+			points[i][d] = min(int(position*float64(len(p.values))), len(p.values)-1)
+		}
+		space.normalize(points[i])
+	}
+
+	return &latinHypercube{sampler: s, points: points}
+}
+
+type latinHypercube struct {
+	*sampler
+	points [][]int // Points not proposed yet
+}
+
+func (l *latinHypercube) Propose(n int) []Combo {
+	combos := make([]Combo, 0)
+	for i := l.remaining(n); i > 0 && len(l.points) > 0; i-- {
+		indices := l.points[0]
+		l.points = l.points[1:]
+
+		if !l.space.valid(indices) || !l.add(indices) {
+			if indices = l.random(); indices == nil {
+				break
+			}
+		}
+		combos = append(combos, l.combo(indices))
+	}
+	return combos
+}
+
+func (l *latinHypercube) Observe(combo Combo, score float64) {}
+
+type TPEOptions struct {
+	Budget     int     // Number of combos to propose, defaults to all combos of the space
+	Seed       int64   // Seed of the random generator, searches with the same seed and observations are identical
+	Startup    int     // Number of observations before modelling, random combos are proposed until then (default 10)
+	Gamma      float64 // Fraction of the best observations modelled as good (default 0.25)
+	Candidates int     // Number of candidates drawn from the good model for each proposal (default 24)
+}
+
+// TPE is a sequential model-based optimiser (Tree-structured Parzen Estimator): it models the values of good and
+// bad observations in each parameter, and proposes the candidates most likely to be good rather than bad.
+//
+// Combos proposed in a batch are chosen from the observations made so far, so smaller batches learn faster.
+// Numeric parameters are smoothed across neighbouring values, other ones are categorical.
+func TPE(space *ParameterSpace, options *TPEOptions) SearchStrategy {
+	t := &tpe{
+		sampler:    newSampler(space, options.Budget, options.Seed),
+		startup:    options.Startup,
+		gamma:      options.Gamma,
+		candidates: options.Candidates,
+		observed:   make(map[string]int),
+	}
+	if t.startup <= 0 {
+		t.startup = 10
+	}
+	if t.gamma <= 0 || t.gamma >= 1 {
+		t.gamma = 0.25
+	}
+	if t.candidates <= 0 {
+		t.candidates = 24
+	}
+	return t
+}
+
+type tpe struct {
+	*sampler
+	startup    int
+	gamma      float64
+	candidates int
+
+	observations []observation
+	observed     map[string]int // Position of each combo in observations
+}
+
+type observation struct {
+	indices []int
+	score   float64
+}
+
+func (t *tpe) Observe(combo Combo, score float64) {
+	indices, ok := t.indices(combo)
+	if !ok {
+		return
+	}
+	if math.IsNaN(score) {
+		score = math.Inf(-1)
+	}
+
+	key := indicesKey(indices)
+	if i, ok := t.observed[key]; ok {
+		t.observations[i].score = score
+		return
+	}
+	t.observed[key] = len(t.observations)
+	t.observations = append(t.observations, observation{indices: indices, score: score})
+}
+
+func (t *tpe) Propose(n int) []Combo {
+	count := t.remaining(n)
+	if count == 0 {
+		return []Combo{}
+	}
+
+	var good, bad [][]float64
+	modelled := len(t.observations) >= t.startup
+	if modelled {
+		good, bad = t.densities()
+	}
+
+	combos := make([]Combo, 0, count)
+	for ; count > 0; count-- {
+		var indices []int
+		if modelled {
+			indices = t.bestCandidate(good, bad)
+		}
+		if indices == nil {
+			indices = t.random()
+		}
+		if indices == nil {
+			break
+		}
+		combos = append(combos, t.combo(indices))
+	}
+
+	return combos
+}
+
+// densities returns the probability of each value of each dimension, among the good and bad observations.
+func (t *tpe) densities() ([][]float64, [][]float64) {
+	sorted := append([]observation(nil), t.observations...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].score > sorted[j].score })
+
+	split := max(1, int(math.Ceil(t.gamma*float64(len(sorted)))))
+	return t.density(sorted[:split]), t.density(sorted[split:])
+}
+
+func (t *tpe) density(observations []observation) [][]float64 {
+	densities := make([][]float64, len(t.space.parameters))
+
+	for d, p := range t.space.parameters {
+		weights := make([]float64, len(p.values))
+
+		// Uniform prior, worth one observation
+		for i := range weights {
+			weights[i] = 1 / float64(len(weights))
+		}
+
+		kernel := make([]float64, len(weights))
+		for _, obs := range observations {
+			center := obs.indices[d]
+			if !p.schema.Type.numeric() {
+				weights[center]++
+				continue
+			}
+
+			// Gaussian kernel over neighbouring values, normalised so that each observation weighs one
+			total := 0.0
+			for i := range kernel {
+				distance := float64(i - center)
+				kernel[i] = math.Exp(-0.5 * distance * distance)
+				total += kernel[i]
+			}
+			for i := range kernel {
+				weights[i] += kernel[i] / total
+			}
+		}
+
+		total := float64(len(observations) + 1)
+		for i := range weights {
+			weights[i] /= total
+		}
+		densities[d] = weights
+	}
+
+	return densities
+}
+
+// bestCandidate draws candidates from the good density, and returns the new one maximising good / bad.
+func (t *tpe) bestCandidate(good, bad [][]float64) []int {
+	var best []int
+	bestRatio := math.Inf(-1)
+
+	parameters := t.space.parameters
+	for c := 0; c < t.candidates; c++ {
+		candidate := make([]int, len(parameters))
+		for d := range parameters {
+			candidate[d] = t.draw(good[d])
+		}
+		t.space.normalize(candidate)
+		if !t.space.valid(candidate) {
+			continue
+		}
+
+		ratio := 0.0
+		for d := range parameters {
+			ratio += math.Log(good[d][candidate[d]]) - math.Log(bad[d][candidate[d]])
+		}
+
+		if ratio > bestRatio && !t.proposed[indicesKey(candidate)] {
+			best, bestRatio = candidate, ratio
+		}
+	}
+
+	if best == nil || !t.add(best) {
+		return nil
+	}
+	return best
+}
+
+func (t *tpe) draw(probabilities []float64) int {
+	r := t.rand.Float64()
+	for i, p := range probabilities {
+		if r -= p; r < 0 {
+			return i
+		}
+	}
+	return len(probabilities) - 1
+}
@@ -2,68 +2,270 @@ package gridsearch
 
 import (
 	"fmt"
+	"math"
+	"sort"
 )
 
-type ParameterSpace map[string][]interface{}
+// ParameterSpace lists the candidate values of each parameter, along with constraints between parameters.
+// Parameters are enumerated by name, so that combos always come out in the same order.
+type ParameterSpace struct {
+	parameters  []*parameter // Sorted by name
+	constraints []func(Combo) bool
+	errs        []error // Invalid declarations, reported by Validate
+}
 
-type Combo map[string]interface{}
+type parameter struct {
+	schema    ParameterSchema
+	values    []interface{}    // Converted to the declared type, numeric ones assumed to be listed in order
+	condition func(Combo) bool // Nil if the parameter always varies
+}
+
+func NewParameterSpace() *ParameterSpace {
+	return &ParameterSpace{}
+}
+
+// Add declares a parameter with its candidate values, e.g. from IntRange, Linspace or Logspace.
+// Its type is inferred from the values, see Declare to check bounds.
+func (space *ParameterSpace) Add(name string, values ...interface{}) *ParameterSpace {
+	return space.AddConditional(name, nil, values...)
+}
+
+// AddConditional declares a parameter which only varies in combos satisfying the condition, e.g. the period of
+// an optional filter. Otherwise it keeps its first value, so that combos differing only by it are not generated.
+func (space *ParameterSpace) AddConditional(name string, condition func(Combo) bool, values ...interface{}) *ParameterSpace {
+	schema, err := inferSchema(name, values)
+	if err != nil {
+		space.errs = append(space.errs, err)
+		return space
+	}
+	return space.DeclareConditional(schema, condition, values...)
+}
+
+// Declare adds a parameter with an explicit schema: values are converted to its type, and checked against its bounds.
+func (space *ParameterSpace) Declare(schema ParameterSchema, values ...interface{}) *ParameterSpace {
+	return space.DeclareConditional(schema, nil, values...)
+}
+
+// DeclareConditional adds a parameter with an explicit schema, only varying in combos satisfying the condition.
+func (space *ParameterSpace) DeclareConditional(schema ParameterSchema, condition func(Combo) bool, values ...interface{}) *ParameterSpace {
+	name := schema.Name
+	if len(values) == 0 {
+		space.errs = append(space.errs, fmt.Errorf("parameter %s: no value", name))
+		return space
+	}
+
+	converted := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		value, err := schema.convert(value)
+		if err != nil {
+			space.errs = append(space.errs, err)
+			continue
+		}
+		converted = append(converted, value)
+	}
+	if len(converted) == 0 {
+		return space
+	}
+
+	p := &parameter{schema: schema, values: converted, condition: condition}
+
+	i := sort.Search(len(space.parameters), func(i int) bool { return space.parameters[i].schema.Name >= name })
+	if i < len(space.parameters) && space.parameters[i].schema.Name == name {
+		space.parameters[i] = p
+	} else {
+		space.parameters = append(space.parameters, nil)
+		copy(space.parameters[i+1:], space.parameters[i:])
+		space.parameters[i] = p
+	}
+
+	return space
+}
+
+// Constrain prunes the combos which do not satisfy the predicate, e.g. a short period above a long one.
+func (space *ParameterSpace) Constrain(predicate func(Combo) bool) *ParameterSpace {
+	space.constraints = append(space.constraints, predicate)
+	return space
+}
+
+// IntRange returns the integers from min to max (inclusive) by step.
+func IntRange(min, max, step int) []interface{} {
+	if step <= 0 {
+		panic("step must be positive")
+	}
+
+	values := make([]interface{}, 0)
+	for v := min; v <= max; v += step {
+		values = append(values, v)
+	}
+	return values
+}
+
+// Linspace returns n evenly spaced floats from min to max (inclusive).
+func Linspace(min, max float64, n int) []interface{} {
+	if n == 1 {
+		return []interface{}{min}
+	}
+
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = min + (max-min)*float64(i)/float64(n-1)
+	}
+	return values
+}
+
+// Logspace returns n floats from min to max (inclusive, both positive) with a constant ratio, e.g. for multipliers.
+func Logspace(min, max float64, n int) []interface{} {
+	if min <= 0 || max <= 0 {
+		panic("logspace bounds must be positive")
+	}
 
-func (space ParameterSpace) GenerateCombinations() []Combo {
-	keys := make([]string, 0, len(space))
-	for k := range space {
-		keys = append(keys, k)
+	values := Linspace(math.Log(min), math.Log(max), n)
+	for i, v := range values {
+		values[i] = math.Exp(v.(float64))
+	}
+
+	// Exact bounds, despite rounding
+	values[0] = min
+	values[len(values)-1] = max
+	return values
+}
+
+// GenerateCombinations returns the valid combos, in a stable order.
+func (space *ParameterSpace) GenerateCombinations() []Combo {
+	return space.GenerateShard(0, 1)
+}
+
+// GenerateShard returns the combos of shard index (from 0) out of count, so that a sweep can be split between
+// processes: every count-th valid combo of the stable order, starting at the index-th.
+func (space *ParameterSpace) GenerateShard(index, count int) []Combo {
+	if count <= 0 || index < 0 || index >= count {
+		panic(fmt.Sprintf("invalid shard %d of %d", index, count))
 	}
 
-	var helper func(int, map[string]interface{})
 	results := []Combo{}
+	position := 0
+	space.enumerate(func(indices []int) {
+		if position%count == index {
+			results = append(results, space.combo(indices))
+		}
+		position++
+	})
+
+	return results
+}
+
+// Size returns the number of valid combos.
+func (space *ParameterSpace) Size() int {
+	size := 0
+	space.enumerate(func(indices []int) { size++ })
+	return size
+}
+
+// enumerate calls yield with the value indices of each valid combo, the last parameter varying first.
+func (space *ParameterSpace) enumerate(yield func(indices []int)) {
+	indices := make([]int, len(space.parameters))
+	for {
+		if space.valid(indices) {
+			yield(indices)
+		}
 
-	helper = func(index int, current map[string]interface{}) {
-		if index == len(keys) {
-			combo := make(map[string]interface{}, len(current))
-			for k, v := range current {
-				combo[k] = v
+		d := len(indices) - 1
+		for ; d >= 0; d-- {
+			indices[d]++
+			if indices[d] < len(space.parameters[d].values) {
+				break
 			}
-			results = append(results, combo)
+			indices[d] = 0
+		}
+		if d < 0 {
 			return
 		}
+	}
+}
+
+func (space *ParameterSpace) combo(indices []int) Combo {
+	combo := make(Combo, len(space.parameters))
+	for d, p := range space.parameters {
+		combo[p.schema.Name] = p.values[indices[d]]
+	}
+	return combo
+}
+
+// indices returns the position of the combo values in each parameter, false if the combo is not in the space.
+func (space *ParameterSpace) indices(combo Combo) ([]int, bool) {
+	indices := make([]int, len(space.parameters))
+	for d, p := range space.parameters {
+		found := false
+		for i, value := range p.values {
+			if value == combo[p.schema.Name] {
+				indices[d], found = i, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return indices, true
+}
 
-		key := keys[index]
-		for _, value := range space[key] {
-			current[key] = value
-			helper(index+1, current)
+// normalize resets the parameters whose condition is not satisfied to their first value.
+func (space *ParameterSpace) normalize(indices []int) {
+	combo := space.combo(indices)
+	for d, p := range space.parameters {
+		if p.condition != nil && !p.condition(combo) {
+			indices[d] = 0
 		}
 	}
+}
 
-	helper(0, map[string]interface{}{})
-	return results
+// valid checks that the combo satisfies the constraints, and is normalized.
+func (space *ParameterSpace) valid(indices []int) bool {
+	combo := space.combo(indices)
+
+	for d, p := range space.parameters {
+		if p.condition != nil && indices[d] != 0 && !p.condition(combo) {
+			return false
+		}
+	}
+	for _, predicate := range space.constraints {
+		if !predicate(combo) {
+			return false
+		}
+	}
+	return true
 }
 
-func comboVal[T any](c Combo, key string) T {
+type Combo map[string]interface{}
+
+// value returns the value of the parameter with the given type, converting numbers leniently (e.g. 20.0 to 20).
+// It panics if the parameter is missing or has another type, see ParameterSpace.Validate to catch it up front.
+func (c Combo) value(key string, t ParameterType) interface{} {
 	val, ok := c[key]
 	if !ok {
-		panic(fmt.Sprintf("Key %s not found", key))
+		panic(fmt.Sprintf("parameter %s not found in combo %v", key, c))
 	}
 
-	typed, ok := val.(T)
-	if !ok {
-		panic(fmt.Sprintf("Value of key %s: wrong type", key))
+	converted, err := convertValue(t, val)
+	if err != nil {
+		panic(fmt.Sprintf("parameter %s: %v", key, err))
 	}
 
-	return typed
+	return converted
 }
 
 func (c Combo) Float(key string) float64 {
-	return comboVal[float64](c, key)
+	return c.value(key, ParameterFloat).(float64)
 }
 
 func (c Combo) Bool(key string) bool {
-	return comboVal[bool](c, key)
+	return c.value(key, ParameterBool).(bool)
 }
 
 func (c Combo) Int(key string) int {
-	return comboVal[int](c, key)
+	return c.value(key, ParameterInt).(int)
 }
 
 func (c Combo) String(key string) string {
-	return comboVal[string](c, key)
+	return c.value(key, ParameterString).(string)
 }
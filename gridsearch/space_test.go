@@ -0,0 +1,88 @@
+package gridsearch_test
+
+import (
+	"go-experiments/gridsearch"
+	"testing"
+)
+
+func testSpace() *gridsearch.ParameterSpace {
+	return gridsearch.NewParameterSpace().
+		Add("period", gridsearch.IntRange(10, 50, 10)...).
+		Add("trailing", true, false).
+		AddConditional("distance", func(c gridsearch.Combo) bool { return c.Bool("trailing") }, 1.0, 2.0).
+		Constrain(func(c gridsearch.Combo) bool { return c.Int("period") != 30 })
+}
+
+func TestShards(t *testing.T) {
+	space := testSpace()
+	all := space.GenerateCombinations()
+	if len(all) != 4*3 || space.Size() != len(all) { // 4 periods, trailing with 2 distances or not trailing
+		t.Fatalf("got %d combos, size %d, expected 12", len(all), space.Size())
+	}
+
+	seen := make(map[string]int)
+	for shard := range 5 {
+		for _, combo := range space.GenerateShard(shard, 5) {
+			seen[gridsearch.ComboToJSON(combo)]++
+		}
+	}
+	for _, combo := range all {
+		if count := seen[gridsearch.ComboToJSON(combo)]; count != 1 {
+			t.Errorf("combo %v in %d shards", combo, count)
+		}
+	}
+}
+
+func TestParseCombo(t *testing.T) {
+	space := testSpace()
+	for _, combo := range space.GenerateCombinations() {
+		parsed, err := space.ParseCombo([]byte(gridsearch.ComboToJSON(combo)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gridsearch.ComboToJSON(parsed) != gridsearch.ComboToJSON(combo) || parsed.Int("period") != combo.Int("period") {
+			t.Fatalf("parsed %v, expected %v", parsed, combo)
+		}
+	}
+}
+
+func TestSearches(t *testing.T) {
+	space := testSpace()
+	valid := make(map[string]bool)
+	for _, combo := range space.GenerateCombinations() {
+		valid[gridsearch.ComboToJSON(combo)] = true
+	}
+
+	for _, name := range gridsearch.SearchNames {
+		search, err := gridsearch.NewSearch(name, space, &gridsearch.SearchOptions{Budget: 8, Seed: 1, Population: 4, Generations: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proposed := make(map[string]bool)
+		for round := 0; round < 10; round++ {
+			combos := search.Propose(4)
+			if len(combos) == 0 {
+				break
+			}
+			for _, combo := range combos {
+				key := gridsearch.ComboToJSON(combo)
+				if !valid[key] {
+					t.Errorf("%s search proposed %v, not a valid combo", name, combo)
+				}
+				if proposed[key] && name != "genetic" {
+					t.Errorf("%s search proposed %v twice", name, combo)
+				}
+				proposed[key] = true
+				search.Observe(combo, float64(combo.Int("period")))
+			}
+		}
+		if name != "grid" && name != "genetic" && len(proposed) > 8 {
+			t.Errorf("%s search proposed %d combos, over its budget of 8", name, len(proposed))
+		}
+	}
+
+	if _, err := gridsearch.NewSearch("unknown", space, &gridsearch.SearchOptions{}); err == nil {
+		t.Errorf("unknown search created")
+	}
+}
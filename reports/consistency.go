@@ -0,0 +1,259 @@
+package reports
+
+import (
+	"encoding/csv"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/runner"
+	"go-experiments/traders"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type ConsistencyOptions struct {
+	Instrument string // Only runs of this instrument, all if empty
+	MinMonths  int    // Strategies run on fewer months are left out, since a few months are consistent by chance
+}
+
+// Consistency summarises the monthly results of a strategy, across all its runs.
+type Consistency struct {
+	Instrument   string
+	Strategy     string // JSON of traders.Spec, as serialized now whatever the format of the runs
+	Params       string // JSON of the gridsearch.Combo the strategy was built from, empty if unknown
+	BrokerConfig string // JSON of backtesting.Config
+	Months       []*MonthResult
+
+	ProfitableMonths float64 // Percentage of months with a positive PnL
+	WorstMonth       *MonthResult
+	MeanPnL          float64 // Monthly
+	StdDevPnL        float64 // Monthly, sample standard deviation
+	TotalPnL         float64
+	TotalTrades      int
+
+	Sharpe         float64 // Monthly, not annualised
+	DeflatedSharpe float64 // Probability that the true Sharpe ratio beats the maximum expected without skill, see ExpectedMaxSharpe
+}
+
+type MonthResult struct {
+	Month   common.Month
+	Metrics *backtesting.Metrics
+}
+
+// ConsistencyLeaderboard groups the stored runs by strategy (along with instrument and broker config) and ranks
+// strategies by consistency across months: percentage of profitable months, then worst month, then standard deviation
+// of the monthly PnL, then total trades.
+//
+// Deflated Sharpe ratios take the ranked strategies of the same instrument and broker config as the trials the best
+// one was selected from, see Trials.
+//
+// Monthly results come from runs of a single month, or from the breakdown of longer runs. Months without trades
+// count as flat months. If a month was run several times (e.g. before an engine change), the latest engine wins.
+// Runs saved without broker config or engine version are left out, since their results cannot be compared.
+func ConsistencyLeaderboard(store runner.Store, options *ConsistencyOptions) ([]*Consistency, error) {
+	type monthRun struct {
+		metrics       *backtesting.Metrics
+		engineVersion int
+	}
+
+	entries := make(map[string]*Consistency)
+	months := make(map[string]map[common.Month]*monthRun)
+	strategies := make(map[string]string) // Normalised JSON by stored JSON
+	legacy := 0
+
+	err := store.ForEachRun(func(r *runner.Run, breakdown map[common.Month]*backtesting.Metrics) error {
+		if options.Instrument != "" && r.Instrument != options.Instrument {
+			return nil
+		}
+		if r.BrokerConfig == "" || r.EngineVersion == 0 {
+			legacy++
+			return nil
+		}
+		timeRange, err := common.ParseTimeRange(r.TimeRange)
+		if err != nil || !timeRange.IsMonthAligned() {
+			return nil // Partial months cannot be compared
+		}
+
+		strategy, ok := strategies[r.Strategy]
+		if !ok {
+			strategy = r.Strategy // Kept as stored if the trader is unknown
+			if spec, err := traders.SpecFromJSON([]byte(r.Strategy)); err == nil {
+				strategy = traders.SpecToJSON(spec)
+			}
+			strategies[r.Strategy] = strategy
+		}
+
+		key := r.Instrument + "\x00" + strategy + "\x00" + r.BrokerConfig
+		if entries[key] == nil {
+			entries[key] = &Consistency{Instrument: r.Instrument, Strategy: strategy, BrokerConfig: r.BrokerConfig}
+			months[key] = make(map[common.Month]*monthRun)
+		}
+		if entries[key].Params == "" {
+			entries[key].Params = r.Params
+		}
+
+		runMonths := timeRange.Months()
+		for _, month := range runMonths {
+			metrics := breakdown[month]
+			if len(runMonths) == 1 {
+				metrics = &r.Metrics
+			} else if metrics == nil {
+				metrics = &backtesting.Metrics{} // No trade opened during the month
+			}
+
+			if existing := months[key][month]; existing == nil || existing.engineVersion < r.EngineVersion {
+				months[key][month] = &monthRun{metrics: metrics, engineVersion: r.EngineVersion}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if legacy > 0 {
+		log.Warning("Left out %d runs saved without broker config or engine version", legacy)
+	}
+
+	leaderboard := make([]*Consistency, 0, len(entries))
+	for key, entry := range entries {
+		if len(months[key]) < max(1, options.MinMonths) {
+			continue
+		}
+		for month, run := range months[key] {
+			entry.Months = append(entry.Months, &MonthResult{Month: month, Metrics: run.metrics})
+		}
+		entry.summarise()
+		leaderboard = append(leaderboard, entry)
+	}
+
+	for _, trials := range Trials(leaderboard) {
+		benchmark := ExpectedMaxSharpe(Sharpes(trials))
+		for _, entry := range trials {
+			entry.DeflatedSharpe = DeflatedSharpe(entry.pnls(), benchmark)
+		}
+	}
+
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		a, b := leaderboard[i], leaderboard[j]
+		switch {
+		case a.ProfitableMonths != b.ProfitableMonths:
+			return a.ProfitableMonths > b.ProfitableMonths
+		case a.WorstMonth.Metrics.NetPnL != b.WorstMonth.Metrics.NetPnL:
+			return a.WorstMonth.Metrics.NetPnL > b.WorstMonth.Metrics.NetPnL
+		case a.StdDevPnL != b.StdDevPnL:
+			return a.StdDevPnL < b.StdDevPnL
+		case a.TotalTrades != b.TotalTrades:
+			return a.TotalTrades > b.TotalTrades
+		default:
+			return a.Strategy < b.Strategy // Stable across runs of the report
+		}
+	})
+
+	return leaderboard, nil
+}
+
+func (c *Consistency) summarise() {
+	sort.Slice(c.Months, func(i, j int) bool { return c.Months[i].Month.Before(c.Months[j].Month) })
+
+	profitable := 0
+	for _, month := range c.Months {
+		pnl := month.Metrics.NetPnL
+		if pnl > 0 {
+			profitable++
+		}
+		if c.WorstMonth == nil || pnl < c.WorstMonth.Metrics.NetPnL {
+			c.WorstMonth = month
+		}
+		c.TotalPnL += pnl
+		c.TotalTrades += month.Metrics.TotalTrades
+	}
+
+	n := float64(len(c.Months))
+	c.ProfitableMonths = float64(profitable) / n * 100
+	c.MeanPnL = c.TotalPnL / n
+
+	if len(c.Months) > 1 {
+		variance := 0.0
+		for _, month := range c.Months {
+			variance += math.Pow(month.Metrics.NetPnL-c.MeanPnL, 2)
+		}
+		c.StdDevPnL = math.Sqrt(variance / (n - 1))
+	}
+	c.Sharpe = Sharpe(c.pnls())
+}
+
+// Sharpes returns the Sharpe ratios of the entries, e.g. for ExpectedMaxSharpe.
+func Sharpes(entries []*Consistency) []float64 {
+	sharpes := make([]float64, len(entries))
+	for i, entry := range entries {
+		sharpes[i] = entry.Sharpe
+	}
+	return sharpes
+}
+
+func (c *Consistency) pnls() []float64 {
+	pnls := make([]float64, len(c.Months))
+	for i, month := range c.Months {
+		pnls[i] = month.Metrics.NetPnL
+	}
+	return pnls
+}
+
+// WriteConsistencyCSV exports the leaderboard, best first, with the monthly PnLs as a column per month.
+func WriteConsistencyCSV(w io.Writer, leaderboard []*Consistency) error {
+	allMonths := make(map[common.Month]bool)
+	for _, entry := range leaderboard {
+		for _, month := range entry.Months {
+			allMonths[month.Month] = true
+		}
+	}
+	columns := make([]common.Month, 0, len(allMonths))
+	for month := range allMonths {
+		columns = append(columns, month)
+	}
+	sort.Slice(columns, func(i, j int) bool { return columns[i].Before(columns[j]) })
+
+	header := []string{"rank", "instrument", "months", "profitable_months_pct", "worst_month", "worst_month_pnl",
+		"mean_pnl", "stddev_pnl", "total_pnl", "total_trades", "sharpe", "deflated_sharpe", "params", "strategy", "broker_config"}
+	for _, month := range columns {
+		header = append(header, "pnl_"+month.String())
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	for i, entry := range leaderboard {
+		record := []string{
+			strconv.Itoa(i + 1), entry.Instrument, strconv.Itoa(len(entry.Months)),
+			format(entry.ProfitableMonths), entry.WorstMonth.Month.String(), format(entry.WorstMonth.Metrics.NetPnL),
+			format(entry.MeanPnL), format(entry.StdDevPnL), format(entry.TotalPnL), strconv.Itoa(entry.TotalTrades),
+			format(entry.Sharpe), format(entry.DeflatedSharpe), entry.Params, entry.Strategy, entry.BrokerConfig,
+		}
+
+		pnls := make(map[common.Month]float64, len(entry.Months))
+		for _, month := range entry.Months {
+			pnls[month.Month] = month.Metrics.NetPnL
+		}
+		for _, month := range columns {
+			if pnl, ok := pnls[month]; ok {
+				record = append(record, format(pnl))
+			} else {
+				record = append(record, "")
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
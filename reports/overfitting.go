@@ -0,0 +1,293 @@
+package reports
+
+import (
+	"fmt"
+	"go-experiments/common"
+	"math"
+	"sort"
+)
+
+const eulerMascheroni = 0.5772156649015329
+
+// maxSplits bounds the blocks of months of the CSCV, since all C(splits, splits/2) combinations are evaluated
+// (12870 for 16 splits).
+const maxSplits = 16
+
+// Overfitting is the result of the combinatorially symmetric cross-validation (CSCV) of a leaderboard, from
+// Bailey, Borwein, López de Prado and Zhu, "The Probability of Backtest Overfitting" (2015).
+type Overfitting struct {
+	Months       []common.Month // Months run by all strategies, the ones cross-validated
+	Strategies   int
+	Splits       int // Blocks of months, half of them being in-sample in each combination
+	Combinations int
+
+	// PBO is the probability of backtest overfitting: the share of combinations where the best in-sample strategy
+	// ranks at or below the out-of-sample median. Above 0.5, picking the best backtest is worse than picking at random.
+	PBO float64
+	// ProbabilityOfLoss is the share of combinations where the best in-sample strategy loses out-of-sample.
+	ProbabilityOfLoss float64
+	Logits            []float64 // Logit of the out-of-sample relative rank of the best in-sample strategy, per combination
+}
+
+// ProbabilityOfOverfitting cross-validates the selection of the best strategy by monthly Sharpe ratio, over the
+// months run by all strategies of the leaderboard. These are split into an even number of blocks (if splits is 0,
+// as many as possible up to 16, the maximum), and every half of the blocks is in turn used in-sample, the other half
+// out-of-sample.
+//
+// The strategies must be trials on the same data, of a single instrument and broker config, see Trials.
+func ProbabilityOfOverfitting(leaderboard []*Consistency, splits int) (*Overfitting, error) {
+	if len(leaderboard) < 2 {
+		return nil, fmt.Errorf("at least 2 strategies are needed, got %d", len(leaderboard))
+	}
+	if groups := len(Trials(leaderboard)); groups > 1 {
+		return nil, fmt.Errorf("strategies of %d instruments or broker configs are not trials on the same data", groups)
+	}
+
+	months := commonMonths(leaderboard)
+	if splits == 0 {
+		splits = min(maxSplits, len(months)) &^ 1
+	}
+	if splits < 2 || splits%2 != 0 || splits > maxSplits {
+		return nil, fmt.Errorf("splits must be even, between 2 and %d, got %d", maxSplits, splits)
+	}
+	if len(months) < max(4, splits) {
+		return nil, fmt.Errorf("%d months run by all strategies, at least %d are needed", len(months), max(4, splits))
+	}
+
+	// pnls[s][t] is the PnL of strategy s in the month t
+	pnls := make([][]float64, len(leaderboard))
+	for s, entry := range leaderboard {
+		byMonth := make(map[common.Month]float64, len(entry.Months))
+		for _, month := range entry.Months {
+			byMonth[month.Month] = month.Metrics.NetPnL
+		}
+		for _, month := range months {
+			pnls[s] = append(pnls[s], byMonth[month])
+		}
+	}
+
+	// blocks[b] holds the indices of the months of the block b, of near-equal sizes
+	blocks := make([][]int, splits)
+	for t := range months {
+		b := t * splits / len(months)
+		blocks[b] = append(blocks[b], t)
+	}
+
+	result := &Overfitting{Months: months, Strategies: len(leaderboard), Splits: splits}
+	overfit, losses := 0, 0
+
+	forEachHalf(splits, func(inSample []bool) {
+		isMonths, oosMonths := make([]int, 0, len(months)), make([]int, 0, len(months))
+		for b, block := range blocks {
+			if inSample[b] {
+				isMonths = append(isMonths, block...)
+			} else {
+				oosMonths = append(oosMonths, block...)
+			}
+		}
+
+		best, bestSharpe := 0, math.Inf(-1)
+		oosSharpes := make([]float64, len(leaderboard))
+		for s := range leaderboard {
+			if sharpe := subsetSharpe(pnls[s], isMonths); sharpe > bestSharpe {
+				best, bestSharpe = s, sharpe
+			}
+			oosSharpes[s] = subsetSharpe(pnls[s], oosMonths)
+		}
+
+		logit := rankLogit(oosSharpes, best)
+		result.Logits = append(result.Logits, logit)
+		if logit <= 0 {
+			overfit++
+		}
+		if subsetMean(pnls[best], oosMonths) < 0 {
+			losses++
+		}
+	})
+
+	result.Combinations = len(result.Logits)
+	result.PBO = float64(overfit) / float64(result.Combinations)
+	result.ProbabilityOfLoss = float64(losses) / float64(result.Combinations)
+	return result, nil
+}
+
+// Trials groups the entries of the leaderboard by instrument and broker config, the strategies of a group being
+// trials on the same data. Groups and their entries keep the order of the leaderboard.
+func Trials(leaderboard []*Consistency) [][]*Consistency {
+	groups := make([][]*Consistency, 0)
+	indices := make(map[string]int)
+	for _, entry := range leaderboard {
+		key := entry.Instrument + "\x00" + entry.BrokerConfig
+		i, ok := indices[key]
+		if !ok {
+			i = len(groups)
+			indices[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], entry)
+	}
+	return groups
+}
+
+// rankLogit returns the logit of the relative rank of the best strategy among the Sharpe ratios, in ]0, 1[ with ties
+// counting as half below. It is positive when the strategy ranks above the median.
+func rankLogit(sharpes []float64, best int) float64 {
+	rank := 1.0
+	for s, sharpe := range sharpes {
+		if sharpe < sharpes[best] {
+			rank++
+		} else if sharpe == sharpes[best] && s != best {
+			rank += 0.5
+		}
+	}
+	omega := rank / float64(len(sharpes)+1)
+	return math.Log(omega / (1 - omega))
+}
+
+// ExpectedMaxSharpe returns the Sharpe ratio expected from the best of the strategies if all of them had no edge,
+// given the dispersion of their Sharpe ratios (non-finite ones being left out).
+func ExpectedMaxSharpe(sharpes []float64) float64 {
+	finite := make([]float64, 0, len(sharpes))
+	for _, sharpe := range sharpes {
+		if isFinite(sharpe) {
+			finite = append(finite, sharpe)
+		}
+	}
+	if len(finite) < 2 {
+		return 0 // No selection
+	}
+
+	mean, variance := 0.0, 0.0
+	for _, sharpe := range finite {
+		mean += sharpe / float64(len(finite))
+	}
+	for _, sharpe := range finite {
+		variance += (sharpe - mean) * (sharpe - mean) / float64(len(finite)-1)
+	}
+
+	n := float64(len(finite))
+	return math.Sqrt(variance) * ((1-eulerMascheroni)*normalQuantile(1-1/n) + eulerMascheroni*normalQuantile(1-1/(n*math.E)))
+}
+
+// DeflatedSharpe returns the probability that the true Sharpe ratio of the returns exceeds the benchmark (e.g. the
+// ExpectedMaxSharpe of the trials), accounting for the sample length, skewness and kurtosis of the returns, from
+// Bailey and López de Prado, "The Deflated Sharpe Ratio" (2014). It is NaN if it cannot be estimated.
+func DeflatedSharpe(returns []float64, benchmark float64) float64 {
+	sharpe := Sharpe(returns)
+	if len(returns) < 2 || !isFinite(sharpe) {
+		return math.NaN()
+	}
+
+	n := float64(len(returns))
+	mean := subsetMean(returns, nil)
+	m2, m3, m4 := 0.0, 0.0, 0.0
+	for _, r := range returns {
+		d := r - mean
+		m2 += d * d / n
+		m3 += d * d * d / n
+		m4 += d * d * d * d / n
+	}
+	skewness, kurtosis := m3/math.Pow(m2, 1.5), m4/(m2*m2)
+
+	variance := 1 - skewness*sharpe + (kurtosis-1)/4*sharpe*sharpe
+	if variance <= 0 {
+		return math.NaN()
+	}
+	return normalCDF((sharpe - benchmark) * math.Sqrt(n-1) / math.Sqrt(variance))
+}
+
+// Sharpe returns the mean of the returns over their sample standard deviation, not annualised, see subsetSharpe for
+// returns without dispersion.
+func Sharpe(returns []float64) float64 {
+	return subsetSharpe(returns, nil)
+}
+
+// commonMonths returns the months run by all strategies, sorted.
+func commonMonths(leaderboard []*Consistency) []common.Month {
+	counts := make(map[common.Month]int)
+	for _, entry := range leaderboard {
+		for _, month := range entry.Months {
+			counts[month.Month]++
+		}
+	}
+
+	months := make([]common.Month, 0, len(counts))
+	for month, count := range counts {
+		if count == len(leaderboard) {
+			months = append(months, month)
+		}
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months
+}
+
+// forEachHalf calls fn with each way of picking half of n items, as a mask.
+func forEachHalf(n int, fn func(picked []bool)) {
+	picked := make([]bool, n)
+	var pick func(from, left int)
+	pick = func(from, left int) {
+		if left == 0 {
+			fn(picked)
+			return
+		}
+		for i := from; i <= n-left; i++ {
+			picked[i] = true
+			pick(i+1, left-1)
+			picked[i] = false
+		}
+	}
+	pick(0, n/2)
+}
+
+// subsetSharpe returns the Sharpe ratio of the values at the indices, all values if indices is nil. Without dispersion,
+// it is the sign of the mean times infinity so that consistent winners still rank first, NaN if the mean is zero.
+func subsetSharpe(values []float64, indices []int) float64 {
+	mean := subsetMean(values, indices)
+
+	n, variance := 0, 0.0
+	forEachIndex(values, indices, func(v float64) {
+		n++
+		variance += (v - mean) * (v - mean)
+	})
+	if n > 1 && variance > 0 {
+		return mean / math.Sqrt(variance/float64(n-1))
+	}
+
+	switch {
+	case mean > 0:
+		return math.Inf(1)
+	case mean < 0:
+		return math.Inf(-1)
+	default:
+		return math.NaN()
+	}
+}
+
+func subsetMean(values []float64, indices []int) float64 {
+	n, total := 0, 0.0
+	forEachIndex(values, indices, func(v float64) {
+		n++
+		total += v
+	})
+	return total / float64(n)
+}
+
+func forEachIndex(values []float64, indices []int, fn func(v float64)) {
+	if indices == nil {
+		for _, v := range values {
+			fn(v)
+		}
+		return
+	}
+	for _, i := range indices {
+		fn(values[i])
+	}
+}
+
+func normalCDF(x float64) float64 {
+	return (1 + math.Erf(x/math.Sqrt2)) / 2
+}
+
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
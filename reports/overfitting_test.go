@@ -0,0 +1,110 @@
+package reports
+
+import (
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"math"
+	"testing"
+)
+
+func TestForEachHalf(t *testing.T) {
+	for n, expected := range map[int]int{2: 2, 4: 6, 8: 70, 16: 12870} {
+		seen := make(map[string]bool)
+		forEachHalf(n, func(picked []bool) {
+			mask, count := make([]byte, n), 0
+			for i, p := range picked {
+				mask[i] = '0'
+				if p {
+					mask[i] = '1'
+					count++
+				}
+			}
+			if count != n/2 {
+				t.Fatalf("picked %d of %d items", count, n)
+			}
+			seen[string(mask)] = true
+		})
+		if len(seen) != expected {
+			t.Errorf("%d distinct halves of %d items, expected C(%d, %d) = %d", len(seen), n, n, n/2, expected)
+		}
+	}
+}
+
+func TestRankLogit(t *testing.T) {
+	for _, test := range []struct {
+		sharpes  []float64
+		best     int
+		expected float64
+	}{
+		{[]float64{3, 1, 2}, 0, math.Log(3)},      // First: rank 3 of 3, omega 3/4
+		{[]float64{3, 1, 2}, 1, -math.Log(3)},     // Last: rank 1, omega 1/4
+		{[]float64{3, 1, 2}, 2, 0},                // Median
+		{[]float64{1, 1, 1}, 0, 0},                // Ties count as half below: rank 2
+		{[]float64{2, 1, 2, 2}, 0, math.Log(1.5)}, // Rank 1 + 1 + 2 * 0.5 = 3, omega 3/5
+	} {
+		if logit := rankLogit(test.sharpes, test.best); math.Abs(logit-test.expected) > 1e-12 {
+			t.Errorf("logit of %d in %v is %v, expected %v", test.best, test.sharpes, logit, test.expected)
+		}
+	}
+}
+
+func TestDeflatedSharpe(t *testing.T) {
+	for _, test := range []struct {
+		returns   []float64
+		benchmark float64
+		expected  float64
+	}{
+		{[]float64{1, 2, 3, 4, 5}, 0, 0.9985219401757457},
+		{[]float64{1, 2, 3, 4, 5}, 1, 0.9200998517078853},
+		{[]float64{1, 2, 3, 4, 5}, math.Sqrt(3.6), 0.5}, // Benchmark equal to the Sharpe ratio
+		{[]float64{-2, 1, 4, 0, 3, 6, -1, 5}, 0.5, 0.6804945927510623},
+	} {
+		if dsr := DeflatedSharpe(test.returns, test.benchmark); math.Abs(dsr-test.expected) > 1e-9 {
+			t.Errorf("deflated Sharpe of %v over %v is %v, expected %v", test.returns, test.benchmark, dsr, test.expected)
+		}
+	}
+
+	if dsr := DeflatedSharpe([]float64{1}, 0); !math.IsNaN(dsr) {
+		t.Errorf("deflated Sharpe of a single return is %v, expected NaN", dsr)
+	}
+}
+
+func TestExpectedMaxSharpe(t *testing.T) {
+	if sharpe := ExpectedMaxSharpe([]float64{-1, 0, 1, math.NaN()}); math.Abs(sharpe-0.8528044961506948) > 1e-9 {
+		t.Errorf("expected max Sharpe %v, expected 0.8528", sharpe)
+	}
+	if sharpe := ExpectedMaxSharpe([]float64{1}); sharpe != 0 {
+		t.Errorf("expected max Sharpe of a single trial %v, expected 0", sharpe)
+	}
+}
+
+func TestProbabilityOfOverfitting(t *testing.T) {
+	// The first strategy beats the others every month: never overfit
+	leaderboard := make([]*Consistency, 3)
+	for s := range leaderboard {
+		leaderboard[s] = &Consistency{Instrument: "EURUSD", BrokerConfig: "{}"}
+		for m := 1; m <= 8; m++ {
+			pnl := float64(10*(3-s) + m%3)
+			leaderboard[s].Months = append(leaderboard[s].Months, &MonthResult{
+				Month: common.NewMonth(2023, m), Metrics: &backtesting.Metrics{NetPnL: pnl},
+			})
+		}
+	}
+
+	overfitting, err := ProbabilityOfOverfitting(leaderboard, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overfitting.Combinations != 6 || overfitting.PBO != 0 || overfitting.ProbabilityOfLoss != 0 {
+		t.Fatalf("got %d combinations, PBO %v and probability of loss %v, expected 6, 0 and 0",
+			overfitting.Combinations, overfitting.PBO, overfitting.ProbabilityOfLoss)
+	}
+
+	leaderboard[2].Instrument = "GBPUSD"
+	if _, err := ProbabilityOfOverfitting(leaderboard, 4); err == nil {
+		t.Fatalf("strategies of two instruments were cross-validated together")
+	}
+	if groups := Trials(leaderboard); len(groups) != 2 || len(groups[0]) != 2 || groups[1][0] != leaderboard[2] {
+		t.Fatalf("unexpected trials %v", groups)
+	}
+}
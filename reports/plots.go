@@ -0,0 +1,185 @@
+package reports
+
+import (
+	"fmt"
+	"go-experiments/gridsearch"
+	"image/color"
+	"math"
+	"os"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+var (
+	missingColor   = color.RGBA{R: 220, G: 220, B: 220, A: 255}
+	highlightColor = color.RGBA{R: 0, G: 170, B: 255, A: 255}
+)
+
+// PlotHeatmap renders the heatmap as a PNG with a color bar, circling the values of the highlighted combo (if any),
+// e.g. the best one, to see whether it sits on a plateau or on an isolated spike.
+func PlotHeatmap(heatmap *Heatmap, title, scoreLabel string, highlight gridsearch.Combo, path string) error {
+	colorMap := moreland.Kindlmann()
+	low, high := scoreRange(heatmap.Scores...)
+	colorMap.SetMin(low)
+	colorMap.SetMax(high)
+
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = heatmap.X
+	p.Y.Label.Text = heatmap.Y
+
+	cells := plotter.NewHeatMap(heatmapGrid{heatmap}, colorMap.Palette(255))
+	cells.Min, cells.Max = low, high
+	cells.NaN = missingColor
+	p.Add(cells)
+
+	p.NominalX(formatValues(heatmap.XValues)...)
+	p.NominalY(formatValues(heatmap.YValues)...)
+
+	if highlight != nil {
+		x, y := indexOf(heatmap.XValues, highlight[heatmap.X]), indexOf(heatmap.YValues, highlight[heatmap.Y])
+		if x >= 0 && y >= 0 {
+			if err := addHighlight(p, float64(x), float64(y)); err != nil {
+				return err
+			}
+		}
+	}
+
+	bar := plot.New()
+	bar.Title.Text = scoreLabel
+	bar.HideX()
+	bar.Y.Padding = 0
+	bar.Add(&plotter.ColorBar{ColorMap: colorMap, Vertical: true})
+
+	width, height, barWidth := vg.Points(900), vg.Points(700), vg.Points(100)
+	canvas := vgimg.New(width, height)
+	dc := draw.New(canvas)
+	p.Draw(draw.Crop(dc, 0, -barWidth, 0, 0))
+	bar.Draw(draw.Crop(dc, width-barWidth+vg.Points(20), 0, vg.Points(20), 0))
+
+	return savePNG(canvas, path)
+}
+
+// PlotCurve renders the curve as a PNG, circling the value of the highlighted combo (if any).
+func PlotCurve(curve *Curve, title, scoreLabel string, highlight gridsearch.Combo, path string) error {
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = curve.Parameter
+	p.Y.Label.Text = scoreLabel
+	p.Add(plotter.NewGrid())
+
+	points := make(plotter.XYs, 0, len(curve.Values))
+	for i, score := range curve.Scores {
+		if isFinite(score) {
+			points = append(points, plotter.XY{X: float64(i), Y: score})
+		}
+	}
+
+	if len(points) > 0 {
+		line, scatter, err := plotter.NewLinePoints(points)
+		if err != nil {
+			return err
+		}
+		scatter.Shape = draw.CircleGlyph{}
+		p.Add(line, scatter)
+	}
+	p.NominalX(formatValues(curve.Values)...)
+
+	if highlight != nil {
+		if x := indexOf(curve.Values, highlight[curve.Parameter]); x >= 0 && isFinite(curve.Scores[x]) {
+			if err := addHighlight(p, float64(x), curve.Scores[x]); err != nil {
+				return err
+			}
+		}
+	}
+
+	canvas := vgimg.New(vg.Points(900), vg.Points(500))
+	p.Draw(draw.New(canvas))
+
+	return savePNG(canvas, path)
+}
+
+func addHighlight(p *plot.Plot, x, y float64) error {
+	marker, err := plotter.NewScatter(plotter.XYs{{X: x, Y: y}})
+	if err != nil {
+		return err
+	}
+	marker.Shape = draw.RingGlyph{}
+	marker.Color = highlightColor
+	marker.Radius = vg.Points(8)
+	p.Add(marker)
+	return nil
+}
+
+// heatmapGrid implements plotter.GridXYZ, values being placed at their index.
+type heatmapGrid struct {
+	heatmap *Heatmap
+}
+
+func (g heatmapGrid) Dims() (int, int) {
+	return len(g.heatmap.XValues), len(g.heatmap.YValues)
+}
+
+func (g heatmapGrid) Z(c, r int) float64 {
+	return g.heatmap.Scores[c][r]
+}
+
+func (g heatmapGrid) X(c int) float64 {
+	return float64(c)
+}
+
+func (g heatmapGrid) Y(r int) float64 {
+	return float64(r)
+}
+
+// scoreRange returns the range of finite scores, widened if empty so that a color map can be built.
+func scoreRange(scores ...[]float64) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, row := range scores {
+		for _, score := range row {
+			if isFinite(score) {
+				low, high = math.Min(low, score), math.Max(high, score)
+			}
+		}
+	}
+
+	switch {
+	case low > high:
+		return 0, 1
+	case low == high:
+		return low - 1, high + 1
+	default:
+		return low, high
+	}
+}
+
+func formatValues(values []interface{}) []string {
+	labels := make([]string, len(values))
+	for i, value := range values {
+		if f, ok := value.(float64); ok {
+			labels[i] = fmt.Sprintf("%.4g", f)
+		} else {
+			labels[i] = fmt.Sprint(value)
+		}
+	}
+	return labels
+}
+
+func savePNG(canvas *vgimg.Canvas, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	png := vgimg.PngCanvas{Canvas: canvas}
+	if _, err := png.WriteTo(file); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
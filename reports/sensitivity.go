@@ -0,0 +1,323 @@
+package reports
+
+import (
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/gridsearch"
+	"go-experiments/runner"
+	"math"
+	"sort"
+	"strings"
+)
+
+var log = common.NewLogger("reports")
+
+// Aggregate combines the scores of the combos sharing the values of the plotted parameters.
+type Aggregate func(scores []float64) float64
+
+var Aggregates = map[string]Aggregate{
+	"mean":   AggregateMean,
+	"median": AggregateMedian,
+	"max":    AggregateMax,
+}
+
+// AggregateMean shows how good the values are on average, whatever the other parameters.
+func AggregateMean(scores []float64) float64 {
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	return total / float64(len(scores))
+}
+
+func AggregateMedian(scores []float64) float64 {
+	sorted := append([]float64(nil), scores...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// AggregateMax shows how good the values can be, with the best other parameters.
+func AggregateMax(scores []float64) float64 {
+	best := math.Inf(-1)
+	for _, score := range scores {
+		best = math.Max(best, score)
+	}
+	return best
+}
+
+// Sweep holds the combos of a parameter space found in the store, along with their scores.
+type Sweep struct {
+	Space  *gridsearch.ParameterSpace
+	Combos []gridsearch.Combo // Converted to the declared types
+	Scores []float64          // Mean objective over the runs of each combo
+}
+
+type SweepOptions struct {
+	Instrument   string             // Only runs of this instrument, required if runs have several
+	TimeRanges   []common.TimeRange // Only runs of these time ranges, all if empty
+	BrokerConfig string             // Only runs with this JSON of backtesting.Config, required if runs have several
+}
+
+// LoadSweep reads the runs built from combos of the space with the current engine, and scores each combo with the mean
+// objective of its runs over time ranges, like the optimisers do.
+//
+// Scores must be comparable: runs of several instruments or broker configs, or of time ranges of different lengths, are refused, and
+// combos which were not run on all the time ranges found are left out. Runs without parameters, or whose parameters
+// do not match the space, are left out too.
+func LoadSweep(store runner.Store, space *gridsearch.ParameterSpace, objective runner.Objective, options *SweepOptions) (*Sweep, error) {
+	type scored struct {
+		combo  gridsearch.Combo
+		scores map[string]float64 // By time range
+	}
+
+	timeRanges := make(map[string]bool, len(options.TimeRanges))
+	for _, timeRange := range options.TimeRanges {
+		timeRanges[timeRange.String()] = true
+	}
+
+	combos := make(map[string]*scored)
+	order := make([]string, 0)
+	found := make(map[string]int) // Months of each time range found
+	instruments := make(map[string]bool)
+	brokerConfigs := make(map[string]bool)
+	mismatched, outdated := 0, 0
+
+	err := store.ForEachRun(func(r *runner.Run, months map[common.Month]*backtesting.Metrics) error {
+		switch {
+		case r.Params == "":
+		case options.Instrument != "" && r.Instrument != options.Instrument:
+		case len(timeRanges) > 0 && !timeRanges[r.TimeRange]:
+		case options.BrokerConfig != "" && r.BrokerConfig != options.BrokerConfig:
+		case r.EngineVersion != backtesting.EngineVersion:
+			outdated++
+		default:
+			combo, err := space.ParseCombo([]byte(r.Params))
+			if err != nil {
+				mismatched++
+				return nil
+			}
+			timeRange, err := common.ParseTimeRange(r.TimeRange)
+			if err != nil {
+				return err
+			}
+
+			key := gridsearch.ComboToJSON(combo)
+			if combos[key] == nil {
+				combos[key] = &scored{combo: combo, scores: make(map[string]float64)}
+				order = append(order, key)
+			}
+			combos[key].scores[r.TimeRange] = objective(&r.Metrics)
+			found[r.TimeRange] = len(timeRange.Months())
+			instruments[r.Instrument] = true
+			brokerConfigs[r.BrokerConfig] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mismatched > 0 {
+		log.Warning("Left out %d runs whose parameters do not match the space", mismatched)
+	}
+	if outdated > 0 {
+		log.Warning("Left out %d runs of another engine version than %d", outdated, backtesting.EngineVersion)
+	}
+
+	if len(instruments) > 1 {
+		return nil, fmt.Errorf("runs of %d instruments cannot be compared, pick one of: %s", len(instruments), strings.Join(sortedKeys(instruments), ", "))
+	}
+	if len(brokerConfigs) > 1 {
+		return nil, fmt.Errorf("runs of %d broker configs cannot be compared, pick one of:\n%s", len(brokerConfigs), strings.Join(sortedKeys(brokerConfigs), "\n"))
+	}
+	lengths := make(map[int]bool)
+	for _, months := range found {
+		lengths[months] = true
+	}
+	if len(lengths) > 1 {
+		return nil, fmt.Errorf("runs of time ranges of %d different lengths cannot be compared, pick some of the same length", len(lengths))
+	}
+
+	sweep := &Sweep{Space: space}
+	incomplete := 0
+	for _, key := range order {
+		combo := combos[key]
+		if len(combo.scores) < len(found) {
+			incomplete++
+			continue
+		}
+
+		total := 0.0
+		for _, score := range combo.scores {
+			total += score
+		}
+		sweep.Combos = append(sweep.Combos, combo.combo)
+		sweep.Scores = append(sweep.Scores, total/float64(len(combo.scores)))
+	}
+
+	if incomplete > 0 {
+		log.Warning("Left out %d combos not run on all the %d time ranges", incomplete, len(found))
+	}
+	return sweep, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Best returns the combo with the best score, nil if no combo has a score.
+func (s *Sweep) Best() (gridsearch.Combo, float64) {
+	var best gridsearch.Combo
+	bestScore := math.Inf(-1)
+	for i, score := range s.Scores {
+		if math.IsNaN(score) {
+			continue
+		}
+		if best == nil || score > bestScore {
+			best, bestScore = s.Combos[i], score
+		}
+	}
+	return best, bestScore
+}
+
+// Curve is the aggregated score of each value of a parameter, over all values of the other parameters.
+type Curve struct {
+	Parameter string
+	Values    []interface{} // Values found in the sweep, sorted
+	Scores    []float64     // Aggregated score of each value, NaN if it has no finite score
+	Counts    []int         // Number of combos aggregated for each value
+}
+
+// Curve returns the sensitivity of the score to a parameter. Combos with non-finite scores (e.g. runs with
+// fewer trades than required) are left out.
+func (s *Sweep) Curve(parameter string, aggregate Aggregate) (*Curve, error) {
+	values, err := s.values(parameter)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([][]float64, len(values))
+	for i, combo := range s.Combos {
+		if !isFinite(s.Scores[i]) {
+			continue
+		}
+		x := indexOf(values, combo[parameter])
+		scores[x] = append(scores[x], s.Scores[i])
+	}
+
+	curve := &Curve{Parameter: parameter, Values: values, Scores: make([]float64, len(values)), Counts: make([]int, len(values))}
+	for x := range values {
+		curve.Scores[x], curve.Counts[x] = aggregateOrNaN(aggregate, scores[x]), len(scores[x])
+	}
+	return curve, nil
+}
+
+// Heatmap is the aggregated score of each pair of values of two parameters, over all values of the other parameters.
+type Heatmap struct {
+	X, Y             string
+	XValues, YValues []interface{} // Values found in the sweep, sorted
+	Scores           [][]float64   // Aggregated score of each pair, indexed by x then y, NaN if it has no finite score
+	Counts           [][]int       // Number of combos aggregated for each pair
+}
+
+// Heatmap returns the sensitivity of the score to two parameters, see Curve.
+func (s *Sweep) Heatmap(x, y string, aggregate Aggregate) (*Heatmap, error) {
+	if x == y {
+		return nil, fmt.Errorf("heatmap parameters must differ, got %s twice", x)
+	}
+
+	xValues, err := s.values(x)
+	if err != nil {
+		return nil, err
+	}
+	yValues, err := s.values(y)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([][][]float64, len(xValues))
+	for i := range scores {
+		scores[i] = make([][]float64, len(yValues))
+	}
+	for i, combo := range s.Combos {
+		if !isFinite(s.Scores[i]) {
+			continue
+		}
+		xi, yi := indexOf(xValues, combo[x]), indexOf(yValues, combo[y])
+		scores[xi][yi] = append(scores[xi][yi], s.Scores[i])
+	}
+
+	heatmap := &Heatmap{X: x, Y: y, XValues: xValues, YValues: yValues}
+	for xi := range xValues {
+		heatmap.Scores = append(heatmap.Scores, make([]float64, len(yValues)))
+		heatmap.Counts = append(heatmap.Counts, make([]int, len(yValues)))
+		for yi := range yValues {
+			heatmap.Scores[xi][yi] = aggregateOrNaN(aggregate, scores[xi][yi])
+			heatmap.Counts[xi][yi] = len(scores[xi][yi])
+		}
+	}
+	return heatmap, nil
+}
+
+// values returns the distinct values of the parameter in the sweep, sorted.
+func (s *Sweep) values(parameter string) ([]interface{}, error) {
+	declared := false
+	for _, schema := range s.Space.Schema() {
+		declared = declared || schema.Name == parameter
+	}
+	if !declared {
+		return nil, fmt.Errorf("unknown parameter %s", parameter)
+	}
+
+	values := make([]interface{}, 0)
+	for _, combo := range s.Combos {
+		if indexOf(values, combo[parameter]) < 0 {
+			values = append(values, combo[parameter])
+		}
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		switch a := values[i].(type) {
+		case int:
+			return a < values[j].(int)
+		case float64:
+			return a < values[j].(float64)
+		case bool:
+			return !a && values[j].(bool)
+		default:
+			return fmt.Sprint(a) < fmt.Sprint(values[j])
+		}
+	})
+	return values, nil
+}
+
+func indexOf(values []interface{}, value interface{}) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func aggregateOrNaN(aggregate Aggregate, scores []float64) float64 {
+	if len(scores) == 0 {
+		return math.NaN()
+	}
+	return aggregate(scores)
+}
+
+func isFinite(score float64) bool {
+	return !math.IsNaN(score) && !math.IsInf(score, 0)
+}
@@ -0,0 +1,50 @@
+package reports_test
+
+import (
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/gridsearch"
+	"go-experiments/reports"
+	"go-experiments/runner"
+	"testing"
+)
+
+func TestLoadSweepInstruments(t *testing.T) {
+	space := gridsearch.NewParameterSpace().Add("period", 10, 20)
+	store := runner.NewMemoryStore()
+	defer store.Close()
+
+	for _, instrument := range []string{"EURUSD", "GBPUSD"} {
+		for i, period := range []string{"10", "20"} {
+			r := &runner.Run{
+				Instrument:    instrument,
+				TimeRange:     "2023-01",
+				Strategy:      `{"name":"test` + period + `"}`,
+				Params:        `{"period":` + period + `}`,
+				BrokerConfig:  `{"InitialCapital":10000}`,
+				EngineVersion: backtesting.EngineVersion,
+				Metrics:       backtesting.Metrics{NetPnL: float64(100 * (i + 1))},
+			}
+			months := map[common.Month]*backtesting.Metrics{common.NewMonth(2023, 1): &r.Metrics}
+			if err := store.SaveRun(r, months, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	objective := runner.Objectives["net-pnl"]
+	if _, err := reports.LoadSweep(store, space, objective, &reports.SweepOptions{}); err == nil {
+		t.Fatalf("runs of two instruments were mixed")
+	}
+
+	sweep, err := reports.LoadSweep(store, space, objective, &reports.SweepOptions{Instrument: "GBPUSD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sweep.Combos) != 2 {
+		t.Fatalf("got %d combos, expected 2", len(sweep.Combos))
+	}
+	if best, score := sweep.Best(); best.Int("period") != 20 || score != 200 {
+		t.Fatalf("best combo %v with score %v, expected period 20 with 200", best, score)
+	}
+}
@@ -0,0 +1,225 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLeaseTimeout = 30 * time.Minute
+	pollTimeout         = 25 * time.Second // Below usual HTTP client and proxy timeouts
+	maxRefusals         = 10               // Refusals of a run before it fails, e.g. if no worker has its data
+	refusalDelay        = 5 * time.Second  // Before handing out a refused run again
+)
+
+// Job is a run handed out to a worker.
+type Job struct {
+	ID       string   `json:"id"` // Lease identifier, a new one each time the run is handed out
+	Spec     *RunSpec `json:"spec"`
+	Checksum string   `json:"checksum"` // Expected checksum of the dataset, so that workers with different data refuse the run
+}
+
+// JobResult is posted back by the worker, with either the results, the error or the abort of the run,
+// or the reason why the worker refused it.
+type JobResult struct {
+	Checksum string                          `json:"checksum"`
+	Metrics  *backtesting.Metrics            `json:"metrics,omitempty"`
+	Months   map[string]*backtesting.Metrics `json:"months,omitempty"` // By month formatted as "2025-01"
+	Trades   []*backtesting.Trade            `json:"trades,omitempty"`
+	Error    string                          `json:"error,omitempty"`
+	Aborted  *backtesting.AbortedError       `json:"aborted,omitempty"` // Set if an abort rule pruned the run
+	Refused  string                          `json:"refused,omitempty"` // Set if the worker cannot run it, e.g. without the same data
+}
+
+// Coordinator is an Executor which serves runs to workers over HTTP and collects their results,
+// so that a sweep can be spread over several processes or machines.
+//
+// Runs are handed out by Execute calls, so the number of runs in progress on workers is bounded by the runner pool.
+// A run whose result is not posted back within the lease timeout, or which is refused by a worker, is handed out again.
+// Late results are ignored. A run refused too many times fails with the last reason.
+type Coordinator struct {
+	leaseTimeout time.Duration
+	leases       chan *lease // Unbuffered: runs are handed out as workers ask for them
+	pending      map[string]*lease
+	nextID       int
+	lock         sync.Mutex
+}
+
+type lease struct {
+	job     Job
+	results chan *JobResult // Buffered, the first result wins
+}
+
+// NewCoordinator creates a coordinator with the given lease timeout (0 for 30 minutes).
+func NewCoordinator(leaseTimeout time.Duration) *Coordinator {
+	if leaseTimeout <= 0 {
+		leaseTimeout = defaultLeaseTimeout
+	}
+
+	return &Coordinator{
+		leaseTimeout: leaseTimeout,
+		leases:       make(chan *lease),
+		pending:      make(map[string]*lease),
+	}
+}
+
+var _ Executor = (*Coordinator)(nil)
+
+// Execute implements Executor: it waits for a worker to take the run and post its result.
+func (c *Coordinator) Execute(ctx context.Context, run *Run, spec *RunSpec) (*RunResult, error) {
+	refusals := 0
+	for attempt := 1; ; attempt++ {
+		l := c.newLease(run, spec)
+
+		select {
+		case c.leases <- l:
+		case <-ctx.Done():
+			c.release(l)
+			return nil, ctx.Err()
+		}
+
+		timeout := time.NewTimer(c.leaseTimeout)
+
+		select {
+		case result := <-l.results:
+			timeout.Stop()
+			if result.Refused != "" {
+				if refusals++; refusals >= maxRefusals {
+					return nil, fmt.Errorf("refused %d times by workers, last time: %s", refusals, result.Refused)
+				}
+
+				log.Warning("🙅 Lease %s of %s refused after attempt %d, handing it out again: %s", l.job.ID, spec, attempt, result.Refused)
+				if !sleep(ctx, refusalDelay) {
+					return nil, ctx.Err()
+				}
+				continue
+			}
+			return c.toRunResult(run, result)
+
+		case <-timeout.C:
+			c.release(l)
+			log.Warning("⏰ Lease %s of %s expired after attempt %d, handing it out again", l.job.ID, spec, attempt)
+
+		case <-ctx.Done():
+			timeout.Stop()
+			c.release(l)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Coordinator) newLease(run *Run, spec *RunSpec) *lease {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nextID++
+	l := &lease{
+		job: Job{
+			ID:       run.Key + "-" + strconv.Itoa(c.nextID),
+			Spec:     spec,
+			Checksum: run.DatasetChecksum,
+		},
+		results: make(chan *JobResult, 1),
+	}
+	c.pending[l.job.ID] = l
+
+	return l
+}
+
+func (c *Coordinator) release(l *lease) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.pending, l.job.ID)
+}
+
+func (c *Coordinator) toRunResult(run *Run, result *JobResult) (*RunResult, error) {
+	if result.Error != "" {
+		return nil, fmt.Errorf("worker failed: %s", result.Error)
+	}
+	if result.Aborted != nil {
+		return nil, result.Aborted
+	}
+	if result.Checksum != run.DatasetChecksum {
+		return nil, fmt.Errorf("worker dataset checksum %s does not match %s", result.Checksum, run.DatasetChecksum)
+	}
+	if result.Metrics == nil {
+		return nil, fmt.Errorf("worker result has no metrics")
+	}
+
+	months := make(map[common.Month]*backtesting.Metrics, len(result.Months))
+	for s, metrics := range result.Months {
+		month, err := common.ParseMonth(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid worker result: %w", err)
+		}
+		months[month] = metrics
+	}
+
+	return &RunResult{Metrics: result.Metrics, Months: months, Trades: result.Trades}, nil
+}
+
+// Handler serves the worker endpoints:
+//
+//	POST /jobs/next         waits for a run, responds with a Job or 204 No Content if none came in time
+//	POST /jobs/{id}/result  posts the JobResult of a run, 410 Gone if the lease expired or was already completed
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs/next", c.handleNext)
+	mux.HandleFunc("POST /jobs/{id}/result", c.handleResult)
+	return mux
+}
+
+func (c *Coordinator) handleNext(w http.ResponseWriter, r *http.Request) {
+	timeout := time.NewTimer(pollTimeout)
+	defer timeout.Stop()
+
+	select {
+	case l := <-c.leases:
+		log.Debug("📤 Handed out %s (%s) to %s", l.job.Spec, l.job.ID, r.RemoteAddr)
+		writeJSON(w, l.job)
+
+	case <-timeout.C:
+		w.WriteHeader(http.StatusNoContent)
+
+	case <-r.Context().Done():
+	}
+}
+
+func (c *Coordinator) handleResult(w http.ResponseWriter, r *http.Request) {
+	var result JobResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, fmt.Sprintf("invalid result: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+
+	c.lock.Lock()
+	l, exists := c.pending[id]
+	delete(c.pending, id)
+	c.lock.Unlock()
+
+	if !exists {
+		log.Info("Ignored result of %s from %s: lease expired or already completed", id, r.RemoteAddr)
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	l.results <- &result
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Error("Failed to write response: %v", err)
+	}
+}
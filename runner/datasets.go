@@ -1,39 +1,373 @@
 package runner
 
 import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"go-experiments/brokers/backtesting"
 	"go-experiments/common"
+	"hash/fnv"
+	"strings"
 	"sync"
 )
 
+// DatasetLoader loads the dataset of an instrument for a month, as ticks or as M1 candles for runs in candle mode.
+type DatasetLoader interface {
+	Load(instrument string, month common.Month) (*backtesting.Dataset, error)
+	LoadCandles(instrument string, month common.Month) (*backtesting.CandleDataset, error)
+
+	// Checksum identifies the dataset Load returns without loading it, since it is part of run keys.
+	Checksum(instrument string, month common.Month) (string, error)
+	// CandleChecksum identifies the dataset LoadCandles returns, like Checksum.
+	CandleChecksum(instrument string, month common.Month) (string, error)
+}
+
+// HistoricalLoader loads datasets from the parquet files of the converter, identified by the hash of the files.
+var HistoricalLoader DatasetLoader = historicalLoader{}
+
+type historicalLoader struct{}
+
+func (historicalLoader) Load(instrument string, month common.Month) (*backtesting.Dataset, error) {
+	return backtesting.LoadDataset(month, month, instrument)
+}
+
+func (historicalLoader) LoadCandles(instrument string, month common.Month) (*backtesting.CandleDataset, error) {
+	return backtesting.LoadCandleDataset(month, month, instrument)
+}
+
+func (historicalLoader) Checksum(instrument string, month common.Month) (string, error) {
+	return backtesting.TickFileChecksum(instrument, month)
+}
+
+func (historicalLoader) CandleChecksum(instrument string, month common.Month) (string, error) {
+	return backtesting.CandleFileChecksum(instrument, month)
+}
+
+// SyntheticLoader generates datasets for the given synthetic instruments, and loads historical data for others.
+// Synthetic instrument names must not collide with real ones, since results are cached per instrument.
+// Each month is generated with a seed derived from the instrument configuration seed, instrument name and month,
+// and identified by the hash of its configuration. Candles are built from the generated ticks.
+func SyntheticLoader(instruments map[string]*backtesting.SyntheticConfig) DatasetLoader {
+	return syntheticLoader(instruments)
+}
+
+type syntheticLoader map[string]*backtesting.SyntheticConfig
+
+func (l syntheticLoader) Load(instrument string, month common.Month) (*backtesting.Dataset, error) {
+	config, ok := l.config(instrument, month)
+	if !ok {
+		return HistoricalLoader.Load(instrument, month)
+	}
+	return backtesting.GenerateDataset(config)
+}
+
+func (l syntheticLoader) LoadCandles(instrument string, month common.Month) (*backtesting.CandleDataset, error) {
+	if _, ok := l.config(instrument, month); !ok {
+		return HistoricalLoader.LoadCandles(instrument, month)
+	}
+
+	dataset, err := l.Load(instrument, month)
+	if err != nil {
+		return nil, err
+	}
+	return backtesting.NewCandleDataset(dataset), nil
+}
+
+func (l syntheticLoader) Checksum(instrument string, month common.Month) (string, error) {
+	config, ok := l.config(instrument, month)
+	if !ok {
+		return HistoricalLoader.Checksum(instrument, month)
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize synthetic config: %w", err)
+	}
+	hash := sha256.Sum256(append([]byte(month.String()+":"), data...)) // Months are not serialized
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// CandleChecksum is the checksum of the generated ticks, which the candles are built from.
+func (l syntheticLoader) CandleChecksum(instrument string, month common.Month) (string, error) {
+	if _, ok := l.config(instrument, month); !ok {
+		return HistoricalLoader.CandleChecksum(instrument, month)
+	}
+	return l.Checksum(instrument, month)
+}
+
+// config returns the generation config of the month, false if the instrument is not synthetic.
+func (l syntheticLoader) config(instrument string, month common.Month) (*backtesting.SyntheticConfig, bool) {
+	base, ok := l[instrument]
+	if !ok {
+		return nil, false
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(fmt.Sprintf("%s:%s", instrument, month.String())))
+
+	config := *base
+	config.Symbol = instrument
+	config.Begin = month
+	config.End = month
+	config.Seed = base.Seed ^ int64(hash.Sum64())
+	return &config, true
+}
+
+// Default memory budget of the dataset cache: a month of EUR/USD ticks is about 150 MB.
+const defaultCacheBudget = 4 << 30
+
+// datasets is a LRU cache of monthly datasets, and of the multi-month datasets merged from them, bounded by a memory
+// budget. Datasets are loaded concurrently, but each one only once at a time. Tick and candle datasets share the cache.
 type datasets struct {
-	datasets map[string]*backtesting.Dataset
-	lock     sync.Mutex
+	checksums map[string]string // Monthly checksums of the loader, computed once
+	entries   map[string]*datasetEntry
+	lru       *list.List // Loaded entries, most recently used first
+	size      int64      // Memory size of loaded entries
+	budget    int64
+	loader    DatasetLoader
+	lock      sync.Mutex
+}
+
+// cachedDataset is a *backtesting.Dataset or a *backtesting.CandleDataset.
+type cachedDataset interface {
+	MemorySize() int64
 }
 
-func newDatasets() *datasets {
+type datasetEntry struct {
+	key     string
+	loaded  chan struct{} // Closed once dataset or err is set
+	dataset cachedDataset
+	err     error
+	element *list.Element // Position in the LRU list, nil while loading
+}
+
+// newDatasets creates the cache with the given budget in bytes (0 for the default budget).
+// The most recently used dataset is always kept, even if it exceeds the budget.
+func newDatasets(loader DatasetLoader, budget int64) *datasets {
+	if budget <= 0 {
+		budget = defaultCacheBudget
+	}
+
 	return &datasets{
-		datasets: make(map[string]*backtesting.Dataset),
-		lock:     sync.Mutex{},
+		checksums: make(map[string]string),
+		entries:   make(map[string]*datasetEntry),
+		lru:       list.New(),
+		budget:    budget,
+		loader:    loader,
 	}
 }
 
 func (d *datasets) Get(instrument string, month common.Month) (*backtesting.Dataset, error) {
+	key := fmt.Sprintf("%s-%s", instrument, month.String())
+
+	dataset, err := d.get(key, func() (cachedDataset, error) {
+		return d.loader.Load(instrument, month)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dataset.(*backtesting.Dataset), nil
+}
+
+// GetCandles is Get for candle datasets.
+func (d *datasets) GetCandles(instrument string, month common.Month) (*backtesting.CandleDataset, error) {
+	key := fmt.Sprintf("%s-%s-candles", instrument, month.String())
+
+	dataset, err := d.get(key, func() (cachedDataset, error) {
+		return d.loader.LoadCandles(instrument, month)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dataset.(*backtesting.CandleDataset), nil
+}
+
+// get returns the cached dataset of the key, loading it with load if missing.
+func (d *datasets) get(key string, load func() (cachedDataset, error)) (cachedDataset, error) {
+	d.lock.Lock()
+	entry, exists := d.entries[key]
+	if exists {
+		if entry.element != nil {
+			d.lru.MoveToFront(entry.element)
+		}
+		d.lock.Unlock()
+
+		// Wait for the load in progress, if any
+		<-entry.loaded
+		return entry.dataset, entry.err
+	}
+
+	entry = &datasetEntry{key: key, loaded: make(chan struct{})}
+	d.entries[key] = entry
+	d.lock.Unlock()
+
+	entry.dataset, entry.err = load()
+	close(entry.loaded)
+
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	key := fmt.Sprintf("%s-%s", instrument, month.String())
+	if entry.err != nil {
+		// Do not cache failures, so that the next run tries again
+		delete(d.entries, key)
+		return nil, entry.err
+	}
+
+	entry.element = d.lru.PushFront(entry)
+	d.size += entry.dataset.MemorySize()
+	d.evict()
 
-	if dataset, exists := d.datasets[key]; exists {
-		return dataset, nil
+	return entry.dataset, nil
+}
+
+// Checksum returns the checksum of the monthly dataset, without loading it.
+func (d *datasets) Checksum(instrument string, month common.Month) (string, error) {
+	return d.checksum(fmt.Sprintf("%s-%s", instrument, month.String()), func() (string, error) {
+		return d.loader.Checksum(instrument, month)
+	})
+}
+
+// CandleChecksum is Checksum for candle datasets.
+func (d *datasets) CandleChecksum(instrument string, month common.Month) (string, error) {
+	return d.checksum(fmt.Sprintf("%s-%s-candles", instrument, month.String()), func() (string, error) {
+		return d.loader.CandleChecksum(instrument, month)
+	})
+}
+
+// checksum returns the cached checksum of the key, computing it with compute if missing.
+func (d *datasets) checksum(key string, compute func() (string, error)) (string, error) {
+	d.lock.Lock()
+	checksum, exists := d.checksums[key]
+	d.lock.Unlock()
+
+	if exists {
+		return checksum, nil
 	}
 
-	dataset, err := backtesting.LoadDataset(month, month, instrument)
+	checksum, err := compute()
+	if err != nil {
+		return "", err
+	}
+
+	d.lock.Lock()
+	d.checksums[key] = checksum
+	d.lock.Unlock()
+
+	return checksum, nil
+}
+
+// Range assembles the dataset of the time range from monthly datasets.
+// Ranges of whole months use whole monthly files, other ranges are sliced.
+// Merged ranges hold their own copy of the ticks, so they are cached and charged to the budget like months.
+func (d *datasets) Range(instrument string, timeRange common.TimeRange) (*backtesting.Dataset, error) {
+	months := timeRange.Months()
+	if len(months) == 1 {
+		dataset, err := d.Get(instrument, months[0])
+		if err != nil || timeRange.IsMonthAligned() {
+			return dataset, err
+		}
+		return dataset.Slice(timeRange), nil
+	}
+
+	key := fmt.Sprintf("%s-%s", instrument, common.MonthRange(months[0], months[len(months)-1]).String())
+	merged, err := d.get(key, func() (cachedDataset, error) {
+		monthly := make([]*backtesting.Dataset, 0, len(months))
+		for _, month := range months {
+			dataset, err := d.Get(instrument, month)
+			if err != nil {
+				return nil, err
+			}
+			monthly = append(monthly, dataset)
+		}
+
+		log.Debug("🧩 Merging %d months of %s", len(months), instrument)
+		return backtesting.MergeDatasets(monthly...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dataset := merged.(*backtesting.Dataset)
+	if !timeRange.IsMonthAligned() {
+		dataset = dataset.Slice(timeRange)
+	}
+
+	return dataset, nil
+}
+
+// CandleRange is Range for candle datasets.
+func (d *datasets) CandleRange(instrument string, timeRange common.TimeRange) (*backtesting.CandleDataset, error) {
+	months := timeRange.Months()
+	if len(months) == 1 {
+		dataset, err := d.GetCandles(instrument, months[0])
+		if err != nil || timeRange.IsMonthAligned() {
+			return dataset, err
+		}
+		return dataset.Slice(timeRange), nil
+	}
+
+	key := fmt.Sprintf("%s-%s-candles", instrument, common.MonthRange(months[0], months[len(months)-1]).String())
+	merged, err := d.get(key, func() (cachedDataset, error) {
+		monthly := make([]*backtesting.CandleDataset, 0, len(months))
+		for _, month := range months {
+			dataset, err := d.GetCandles(instrument, month)
+			if err != nil {
+				return nil, err
+			}
+			monthly = append(monthly, dataset)
+		}
+
+		log.Debug("🧩 Merging %d months of %s candles", len(months), instrument)
+		return backtesting.MergeCandleDatasets(monthly...)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	d.datasets[key] = dataset
+	dataset := merged.(*backtesting.CandleDataset)
+	if !timeRange.IsMonthAligned() {
+		dataset = dataset.Slice(timeRange)
+	}
+
 	return dataset, nil
 }
+
+// RangeChecksum identifies the data of the time range from monthly checksums, of the candles or of the ticks, without
+// assembling the dataset. The time range itself is part of the run key.
+func (d *datasets) RangeChecksum(instrument string, timeRange common.TimeRange, candles bool) (string, error) {
+	checksum := d.Checksum
+	if candles {
+		checksum = d.CandleChecksum
+	}
+
+	months := timeRange.Months()
+	checksums := make([]string, 0, len(months))
+
+	for _, month := range months {
+		monthly, err := checksum(instrument, month)
+		if err != nil {
+			return "", err
+		}
+		checksums = append(checksums, monthly)
+	}
+
+	if len(checksums) == 1 {
+		return checksums[0], nil
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(checksums, ":")))
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// evict removes least recently used datasets until the cache fits in its budget.
+// Evicted datasets still in use by runs are freed once the runs complete.
+func (d *datasets) evict() {
+	for d.size > d.budget && d.lru.Len() > 1 {
+		entry := d.lru.Remove(d.lru.Back()).(*datasetEntry)
+		delete(d.entries, entry.key)
+		d.size -= entry.dataset.MemorySize()
+
+		log.Debug("🗑️  Evicted dataset %s from cache", entry.key)
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"go-experiments/brokers"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+)
+
+// RunResult is everything saved from a run.
+type RunResult struct {
+	Metrics *backtesting.Metrics
+	Months  map[common.Month]*backtesting.Metrics
+	Trades  []*backtesting.Trade
+}
+
+// Executor runs the backtest of a run, locally or remotely.
+type Executor interface {
+	Execute(ctx context.Context, run *Run, spec *RunSpec) (*RunResult, error)
+}
+
+type localExecutor struct {
+	datasets *datasets
+}
+
+var _ Executor = (*localExecutor)(nil)
+
+// Execute implements Executor.
+func (e *localExecutor) Execute(ctx context.Context, run *Run, spec *RunSpec) (*RunResult, error) {
+	broker, err := newBroker(e.datasets, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return runBacktest(broker, spec)
+}
+
+// newBroker creates the broker of the run, driven by candles in candle mode and by ticks otherwise.
+func newBroker(datasets *datasets, spec *RunSpec) (brokers.BacktestingBroker, error) {
+	if spec.Broker.Candles {
+		dataset, err := datasets.CandleRange(spec.Instrument, spec.TimeRange)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get candle dataset for %s: %w", spec, err)
+		}
+
+		broker, err := backtesting.NewCandleBroker(&spec.Broker, dataset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create candle broker: %w", err)
+		}
+		return broker, nil
+	}
+
+	dataset, err := datasets.Range(spec.Instrument, spec.TimeRange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset for %s: %w", spec, err)
+	}
+
+	broker, err := backtesting.NewBroker(&spec.Broker, dataset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create broker: %w", err)
+	}
+	return broker, nil
+}
+
+func runBacktest(broker brokers.BacktestingBroker, spec *RunSpec) (*RunResult, error) {
+	if err := spec.Trader.Setup(broker); err != nil {
+		return nil, fmt.Errorf("failed to setup trader: %w", err)
+	}
+	if err := broker.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run broker: %w", err)
+	}
+
+	metrics, err := backtesting.ComputeTotalMetrics(broker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute metrics: %w", err)
+	}
+
+	months, err := backtesting.ComputeMetrics(broker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute monthly metrics: %w", err)
+	}
+
+	trades, err := backtesting.Trades(broker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+
+	return &RunResult{Metrics: metrics, Months: months, Trades: trades}, nil
+}
@@ -0,0 +1,69 @@
+package runner_test
+
+import (
+	"context"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/runner"
+	"go-experiments/strategies"
+	"go-experiments/traders"
+	"strings"
+	"testing"
+)
+
+func TestCandleRuns(t *testing.T) {
+	first, last := common.NewMonth(2023, 1), common.NewMonth(2023, 2)
+	r, err := runner.NewRunnerWithOptions(context.Background(), &runner.Options{
+		Store: runner.NewMemoryStore(),
+		Loader: runner.SyntheticLoader(map[string]*backtesting.SyntheticConfig{
+			"SYN": backtesting.DefaultSyntheticConfig("SYN", first, last, 1),
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	combo := strategies.BreakoutSpace.GenerateShard(0, 1)[0]
+	newSpec := func(candles bool, intrabar backtesting.IntrabarResolution) *runner.RunSpec {
+		spec := runner.NewRunSpec("SYN", common.MonthRange(first, last), traders.ModularSpec(strategies.BreakoutBuilder(combo)))
+		spec.Broker.Candles, spec.Broker.Intrabar = candles, intrabar
+		return spec
+	}
+	ticks, candles := newSpec(false, backtesting.IntrabarWorstCase), newSpec(true, backtesting.IntrabarTickDrilldown)
+	for _, spec := range []*runner.RunSpec{ticks, candles} {
+		if err := r.SubmitRun(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := make([]*runner.Run, 0, 2)
+	for _, spec := range []*runner.RunSpec{ticks, candles} {
+		run, err := r.FindRun(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run == nil {
+			status, message, _ := r.FindRunStatus(spec)
+			t.Fatalf("run did not succeed: %s %s", status, message)
+		}
+		if run.TotalTrades == 0 {
+			t.Fatalf("no trade on the synthetic dataset, candles %v", spec.Broker.Candles)
+		}
+		runs = append(runs, run)
+	}
+	if runs[0].Key == runs[1].Key {
+		t.Fatalf("tick and candle runs share key %s", runs[0].Key)
+	}
+	if strings.Contains(runs[0].BrokerConfig, "Intrabar") || strings.Contains(runs[0].BrokerConfig, "Candles") {
+		t.Fatalf("tick run keyed with candle settings: %s", runs[0].BrokerConfig)
+	}
+
+	// Ignored by tick runs
+	if run, err := r.FindRun(newSpec(false, backtesting.IntrabarOHLCPath)); err != nil || run == nil || run.Key != runs[0].Key {
+		t.Fatalf("intrabar resolution changed the tick run %v, error %v", run, err)
+	}
+}
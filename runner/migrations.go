@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Schema migrations, applied in order. The index of the last applied migration is stored in PRAGMA user_version.
+// Never edit an existing migration, add a new one instead.
+var migrations = []string{
+	// 1: initial schema (tables may already exist from before migrations were introduced)
+	`
+    CREATE TABLE IF NOT EXISTS runs (
+        -- Config
+        key TEXT PRIMARY KEY,                -- Unique hash for config
+        instrument TEXT NOT NULL,            -- e.g., EURUSD
+        time_range TEXT NOT NULL,             -- e.g., 2025-01, 2025-01..2025-03 (see common.TimeRange)
+        strategy TEXT NOT NULL,               -- Serialized strategy description (JSON)
+
+        -- Metrics
+        total_trades INTEGER NOT NULL,        -- Total trades
+        win_rate REAL NOT NULL,               -- % of winning trades
+        net_pnl REAL NOT NULL,                 -- Net profit/loss in base currency
+        profit_factor REAL NOT NULL,           -- Gross profit / gross loss
+        max_drawdown_pct REAL NOT NULL,        -- % from peak equity
+        expected_value_r REAL NOT NULL,        -- Avg R-multiple return
+        avg_trade_duration_seconds INTEGER NOT NULL, -- Duration in seconds
+        long_trades INTEGER NOT NULL,          -- Count of long trades
+        short_trades INTEGER NOT NULL          -- Count of short trades
+    );
+
+    CREATE TABLE IF NOT EXISTS run_months (
+        run_key TEXT NOT NULL REFERENCES runs(key), -- Run of the breakdown
+        month TEXT NOT NULL,                  -- e.g., 2025-01 (month of position opening)
+
+        -- Metrics
+        total_trades INTEGER NOT NULL,
+        win_rate REAL NOT NULL,
+        net_pnl REAL NOT NULL,
+        profit_factor REAL NOT NULL,
+        max_drawdown_pct REAL NOT NULL,
+        expected_value_r REAL NOT NULL,
+        avg_trade_duration_seconds INTEGER NOT NULL,
+        long_trades INTEGER NOT NULL,
+        short_trades INTEGER NOT NULL,
+
+        PRIMARY KEY (run_key, month)
+    );
+
+    CREATE TABLE IF NOT EXISTS trades (
+        run_key TEXT NOT NULL REFERENCES runs(key), -- Run of the trade
+        direction TEXT NOT NULL,              -- long or short
+        quantity INTEGER NOT NULL,            -- Number of lots
+        open_time TIMESTAMP NOT NULL,
+        open_price REAL NOT NULL,
+        close_time TIMESTAMP NOT NULL,
+        close_price REAL NOT NULL,
+        stop_loss REAL NOT NULL,
+        take_profit REAL NOT NULL,
+        exit_reason TEXT NOT NULL,            -- stop loss, take profit or end of test
+        pnl REAL NOT NULL                     -- Profit/loss in base currency
+    );
+
+    CREATE INDEX IF NOT EXISTS trades_run_key ON trades (run_key);`,
+
+	// 2: reproducibility metadata (older runs keep empty values, their keys do not match anymore)
+	`
+    ALTER TABLE runs ADD COLUMN broker_config TEXT NOT NULL DEFAULT '';   -- Serialized backtesting.Config (JSON)
+    ALTER TABLE runs ADD COLUMN dataset_checksum TEXT NOT NULL DEFAULT ''; -- See backtesting.Dataset.Checksum
+    ALTER TABLE runs ADD COLUMN engine_version INTEGER NOT NULL DEFAULT 0; -- See backtesting.EngineVersion`,
+
+	// 3: run status, to record failures and resume interrupted sweeps
+	`
+    CREATE TABLE run_status (
+        key TEXT PRIMARY KEY,                 -- Key of the run (see runs.key)
+        instrument TEXT NOT NULL,
+        time_range TEXT NOT NULL,
+        strategy TEXT NOT NULL,
+        status TEXT NOT NULL,                 -- queued, running, succeeded or failed
+        error TEXT NOT NULL DEFAULT '',       -- Error of failed runs
+        updated_at TIMESTAMP NOT NULL
+    );
+
+    INSERT INTO run_status (key, instrument, time_range, strategy, status, updated_at)
+    SELECT key, instrument, time_range, strategy, 'succeeded', CURRENT_TIMESTAMP FROM runs;`,
+
+	// 4: gridsearch parameters of the strategy, for analysis (not part of the key)
+	`
+    ALTER TABLE runs ADD COLUMN params TEXT NOT NULL DEFAULT ''; -- Serialized gridsearch.Combo (JSON), empty if unknown`,
+
+	// 5: absolute drawdown, for return over drawdown objectives (NULL for runs saved before, and read as NaN)
+	`
+    ALTER TABLE runs ADD COLUMN max_drawdown REAL;       -- Largest drop from peak equity in base currency
+    ALTER TABLE run_months ADD COLUMN max_drawdown REAL;`,
+
+	// 6: absolute drawdown of runs saved before, from their trades, like backtesting.Metrics.MaxDrawdown: closed-trade
+	// equity in opening order from 0, for the run and for each month of opening (runs missing trades keep NULL)
+	`
+    CREATE TEMP TABLE trade_drawdowns AS
+    WITH curves AS (
+        SELECT run_key, substr(open_time, 1, 7) AS month, rowid AS id,
+            SUM(pnl) OVER (PARTITION BY run_key ORDER BY rowid) AS run_equity,
+            SUM(pnl) OVER (PARTITION BY run_key, substr(open_time, 1, 7) ORDER BY rowid) AS month_equity
+        FROM trades
+        WHERE run_key IN (SELECT key FROM runs WHERE max_drawdown IS NULL)
+    )
+    SELECT run_key, month,
+        MAX(0, MAX(run_equity) OVER (PARTITION BY run_key ORDER BY id)) - run_equity AS run_drawdown,
+        MAX(0, MAX(month_equity) OVER (PARTITION BY run_key, month ORDER BY id)) - month_equity AS month_drawdown
+    FROM curves;
+
+    UPDATE runs SET max_drawdown = (
+        SELECT COALESCE(MAX(run_drawdown), 0) FROM trade_drawdowns WHERE run_key = runs.key
+    ) WHERE max_drawdown IS NULL AND total_trades = (SELECT COUNT(*) FROM trade_drawdowns WHERE run_key = runs.key);
+
+    UPDATE run_months SET max_drawdown = (
+        SELECT COALESCE(MAX(month_drawdown), 0) FROM trade_drawdowns
+        WHERE run_key = run_months.run_key AND month = run_months.month
+    ) WHERE max_drawdown IS NULL AND run_key IN (SELECT key FROM runs WHERE max_drawdown IS NOT NULL);
+
+    DROP TABLE trade_drawdowns;`,
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(migrations))
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := applyMigration(db, version+1, migrations[version]); err != nil {
+			return fmt.Errorf("failed to migrate schema to version %d: %w", version+1, err)
+		}
+
+		log.Info("🗄️  Migrated database schema to version %d", version+1)
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, migration string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+
+	// PRAGMA does not support parameters
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d;", version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Objective scores the metrics of a run, higher is better. NaN (e.g. a metric unknown for older runs) ranks last.
+type Objective func(metrics *backtesting.Metrics) float64
+
+// Objectives can be selected by name, e.g. from a command line flag.
+var Objectives = map[string]Objective{
+	"net-pnl":         NetPnL,
+	"profit-factor":   ProfitFactor,
+	"expectancy":      Expectancy,
+	"return-drawdown": ReturnOverDrawdown,
+	"win-rate":        func(metrics *backtesting.Metrics) float64 { return metrics.WinRate },
+	"trades":          func(metrics *backtesting.Metrics) float64 { return float64(metrics.TotalTrades) },
+}
+
+func NetPnL(metrics *backtesting.Metrics) float64 {
+	return metrics.NetPnL
+}
+
+// ProfitFactor is infinite for runs without losing trades, rather than 0 as stored.
+func ProfitFactor(metrics *backtesting.Metrics) float64 {
+	if metrics.ProfitFactor == 0 && metrics.NetPnL > 0 {
+		return math.Inf(1)
+	}
+	return metrics.ProfitFactor
+}
+
+// Expectancy is the average return per trade in R-multiples.
+func Expectancy(metrics *backtesting.Metrics) float64 {
+	return metrics.ExpectedValueR
+}
+
+// ReturnOverDrawdown is the net PnL relative to the largest drawdown, infinite for profitable runs without drawdown.
+func ReturnOverDrawdown(metrics *backtesting.Metrics) float64 {
+	switch {
+	case math.IsNaN(metrics.MaxDrawdown):
+		return math.NaN()
+	case metrics.MaxDrawdown > 0:
+		return metrics.NetPnL / metrics.MaxDrawdown
+	case metrics.NetPnL > 0:
+		return math.Inf(1)
+	default:
+		return 0
+	}
+}
+
+// MinTrades constrains the objective: runs with fewer trades than min score -Inf, so that a few lucky trades never win.
+func MinTrades(objective Objective, min int) Objective {
+	return func(metrics *backtesting.Metrics) float64 {
+		if metrics.TotalTrades < min {
+			return math.Inf(-1)
+		}
+		return objective(metrics)
+	}
+}
+
+// ParseObjectives parses comma separated objective names (see Objectives), e.g. "net-pnl,return-drawdown".
+// Runs with fewer than minTrades trades score -Inf on every objective (0 to disable).
+func ParseObjectives(names string, minTrades int) ([]Objective, error) {
+	objectives := make([]Objective, 0)
+	for _, name := range strings.Split(names, ",") {
+		objective, ok := Objectives[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown objective '%s', expected one of %s", name, strings.Join(ObjectiveNames(), ", "))
+		}
+		if minTrades > 0 {
+			objective = MinTrades(objective, minTrades)
+		}
+		objectives = append(objectives, objective)
+	}
+	return objectives, nil
+}
+
+// FormatScores formats the scores along with the comma separated names of their objectives, as parsed by ParseObjectives.
+func FormatScores(names string, scores []float64) string {
+	parts := make([]string, len(scores))
+	for i, name := range strings.Split(names, ",") {
+		parts[i] = fmt.Sprintf("%s %.4f", strings.TrimSpace(name), scores[i])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ObjectiveNames returns the names of Objectives, sorted.
+func ObjectiveNames() []string {
+	names := make([]string, 0, len(Objectives))
+	for name := range Objectives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"fmt"
+	"go-experiments/gridsearch"
+	"math"
+	"sort"
+)
+
+type OptimizeOptions struct {
+	Search gridsearch.SearchStrategy
+	Batch  int                                     // Number of combos proposed at a time, 0 for the whole budget at once
+	Specs  func(combo gridsearch.Combo) []*RunSpec // Runs of a combo, its scores are the mean objectives of those which succeed
+
+	// Objectives define the best combos: with several ones, combos are ranked by Pareto front,
+	// and the search is guided by the ranks rather than by the scores.
+	Objectives []Objective
+}
+
+type OptimizeResult struct {
+	Combos []*ScoredCombo // Combos with at least one successful run, best first (see RankCombos)
+}
+
+type ScoredCombo struct {
+	Combo  gridsearch.Combo
+	Scores []float64 // Mean of each objective over the successful runs of the combo
+	Rank   int       // Pareto front, 0 for the combos which no other one beats on every objective
+}
+
+// Best returns the best combo on the first objective among the Pareto front, nil if no run succeeded.
+func (r *OptimizeResult) Best() *ScoredCombo {
+	if len(r.Combos) == 0 {
+		return nil
+	}
+	return r.Combos[0]
+}
+
+// Front returns the combos which no other one beats on every objective.
+func (r *OptimizeResult) Front() []*ScoredCombo {
+	i := sort.Search(len(r.Combos), func(i int) bool { return r.Combos[i].Rank > 0 })
+	return r.Combos[:i]
+}
+
+// RankCombos sets the Pareto rank of the combos, and sorts them best first: by rank, then on each objective in order.
+func RankCombos(combos []*ScoredCombo) {
+	scores := make([][]float64, len(combos))
+	for i, combo := range combos {
+		scores[i] = combo.Scores
+	}
+	for i, rank := range gridsearch.ParetoRanks(scores) {
+		combos[i].Rank = rank
+	}
+
+	sort.SliceStable(combos, func(i, j int) bool {
+		if combos[i].Rank != combos[j].Rank {
+			return combos[i].Rank < combos[j].Rank
+		}
+		for d := range combos[i].Scores {
+			a, b := combos[i].Scores[d], combos[j].Scores[d]
+			if a != b && !(math.IsNaN(a) && math.IsNaN(b)) {
+				return a > b || math.IsNaN(b)
+			}
+		}
+		return false
+	})
+}
+
+// Optimize runs the combos proposed by the search, and reports their scores back to it until its budget is spent.
+// Runs completed earlier are found in the store instead of being run again, so an optimisation can be resumed.
+// On error (e.g. interrupted), the combos scored so far are returned along with the error.
+func (r *Runner) Optimize(options *OptimizeOptions) (*OptimizeResult, error) {
+	if len(options.Objectives) == 0 {
+		return nil, fmt.Errorf("no objective to optimise")
+	}
+
+	result := &OptimizeResult{}
+	defer func() { RankCombos(result.Combos) }()
+
+	for {
+		combos := options.Search.Propose(options.Batch)
+		if len(combos) == 0 {
+			return result, nil
+		}
+
+		specs := make([][]*RunSpec, len(combos))
+		for i, combo := range combos {
+			specs[i] = options.Specs(combo)
+			for _, spec := range specs[i] {
+				if err := r.SubmitRun(spec); err != nil {
+					return result, err
+				}
+			}
+		}
+
+		// Scores of this batch guide the next proposals
+		if err := r.Wait(); err != nil {
+			return result, err
+		}
+
+		for i, combo := range combos {
+			scores, ok, err := r.scores(specs[i], options.Objectives)
+			if err != nil {
+				return result, err
+			}
+			if !ok {
+				continue
+			}
+
+			result.Combos = append(result.Combos, &ScoredCombo{Combo: combo, Scores: scores})
+			if len(options.Objectives) == 1 {
+				options.Search.Observe(combo, scores[0])
+			}
+		}
+
+		if len(options.Objectives) > 1 {
+			// Ranks change as combos are scored, all combos are observed again
+			RankCombos(result.Combos)
+			for _, scored := range result.Combos {
+				options.Search.Observe(scored.Combo, -float64(scored.Rank))
+			}
+		}
+	}
+}
+
+// scores returns the mean objectives of the successful runs, false if none succeeded.
+// Combos with a pruned run are hopeless and score worst on every objective.
+func (r *Runner) scores(specs []*RunSpec, objectives []Objective) ([]float64, bool, error) {
+	totals := make([]float64, len(objectives))
+	count := 0
+	for _, spec := range specs {
+		run, err := r.FindRun(spec)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to find run for %s: %w", spec, err)
+		}
+		if run == nil {
+			status, _, err := r.FindRunStatus(spec)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to find run status for %s: %w", spec, err)
+			}
+			if status == RunStatusPruned {
+				return worstScores(len(objectives)), true, nil
+			}
+			continue // Failed
+		}
+		for i, objective := range objectives {
+			totals[i] += objective(&run.Metrics)
+		}
+		count++
+	}
+
+	if count == 0 {
+		return nil, false, nil
+	}
+	for i := range totals {
+		totals[i] /= float64(count)
+	}
+	return totals, true, nil
+}
+
+func worstScores(n int) []float64 {
+	scores := make([]float64, n)
+	for i := range scores {
+		scores[i] = math.Inf(-1)
+	}
+	return scores
+}
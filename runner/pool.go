@@ -1,23 +1,80 @@
 package runner
 
 import (
+	"context"
+	"fmt"
 	"runtime"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
-type Task func()
+// Task returns an error to be counted as failed. Panics are recovered and counted as failures too.
+type Task func(ctx context.Context) error
+
+type PoolOptions struct {
+	Workers   int // Number of concurrent tasks, defaults to the number of CPU cores
+	QueueSize int // Number of pending tasks before Submit blocks, defaults to twice the number of workers
+}
+
+// Progress is a snapshot of the pool counters.
+type Progress struct {
+	Expected int // Total number of tasks announced with Expect, if known
+	Queued   int
+	Running  int
+	Done     int // Succeeded tasks
+	Failed   int
+	Canceled int // Tasks skipped because the context was canceled
+	Skipped  int // Tasks not submitted by the caller, e.g. already done
+
+	Elapsed time.Duration
+	ETA     time.Duration // 0 if unknown
+}
+
+func (p Progress) Finished() int {
+	return p.Done + p.Failed + p.Canceled + p.Skipped
+}
+
+func (p Progress) String() string {
+	total := max(p.Expected, p.Finished()+p.Running+p.Queued)
+	s := fmt.Sprintf("%d/%d finished (%d failed, %d canceled, %d skipped), %d running, %d queued, elapsed %s",
+		p.Finished(), total, p.Failed, p.Canceled, p.Skipped, p.Running, p.Queued, p.Elapsed.Round(time.Second))
+	if p.ETA > 0 {
+		s += fmt.Sprintf(", ETA %s", p.ETA.Round(time.Second))
+	}
+	return s
+}
 
 type TaskPool struct {
-	wg     sync.WaitGroup
-	tasks  chan Task
-	closed bool
+	ctx   context.Context
+	wg    sync.WaitGroup
+	tasks chan Task
+	begin time.Time
+
+	submitLock sync.RWMutex // Held by Submit while sending, so that Close does not close the channel meanwhile
+	closed     bool
+	pending    sync.WaitGroup // Submitted tasks not finished yet
+
+	lock     sync.Mutex
+	progress Progress
 }
 
-func NewTaskPool() *TaskPool {
-	workers := runtime.NumCPU() // Use number of CPU cores as default
+// NewTaskPool starts the workers. Once ctx is canceled, pending tasks are skipped and Submit fails.
+func NewTaskPool(ctx context.Context, options *PoolOptions) *TaskPool {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU() // Use number of CPU cores as default
+	}
+
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = 2 * workers
+	}
 
 	p := &TaskPool{
-		tasks: make(chan Task, 10000000),
+		ctx:   ctx,
+		tasks: make(chan Task, queueSize),
+		begin: time.Now(),
 	}
 
 	p.wg.Add(workers)
@@ -26,7 +83,7 @@ func NewTaskPool() *TaskPool {
 		go func(id int) {
 			defer p.wg.Done()
 			for task := range p.tasks {
-				task()
+				p.execute(task)
 			}
 		}(i)
 	}
@@ -34,17 +91,121 @@ func NewTaskPool() *TaskPool {
 	return p
 }
 
-func (p *TaskPool) Submit(task Task) {
+// Submit enqueues the task, blocking while the queue is full.
+func (p *TaskPool) Submit(task Task) error {
+	p.submitLock.RLock()
+	defer p.submitLock.RUnlock()
+
 	if p.closed {
-		panic("submit on closed pool")
+		return fmt.Errorf("submit on closed pool")
+	}
+
+	p.lock.Lock()
+	p.progress.Queued++
+	p.lock.Unlock()
+
+	p.pending.Add(1)
+
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-p.ctx.Done():
+		p.pending.Done()
+		p.lock.Lock()
+		p.progress.Queued--
+		p.progress.Canceled++
+		p.lock.Unlock()
+		return p.ctx.Err()
+	}
+}
+
+// Expect announces the total number of tasks which will be submitted, so that the ETA covers all of them.
+func (p *TaskPool) Expect(total int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.progress.Expected = total
+}
+
+// Skip counts a task which will not be submitted, so that it is not expected anymore.
+func (p *TaskPool) Skip() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.progress.Skipped++
+}
+
+func (p *TaskPool) Progress() Progress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	progress := p.progress
+	progress.Elapsed = time.Since(p.begin)
+
+	// Assume the remaining tasks run at the average pace so far
+	finished := progress.Done + progress.Failed
+	remaining := max(progress.Expected, progress.Finished()+progress.Running+progress.Queued) - progress.Finished()
+	if finished > 0 && remaining > 0 && p.ctx.Err() == nil {
+		progress.ETA = progress.Elapsed / time.Duration(finished) * time.Duration(remaining)
 	}
-	p.tasks <- task
+
+	return progress
+}
+
+// Wait waits for the tasks submitted so far, without closing the pool.
+func (p *TaskPool) Wait() {
+	p.pending.Wait()
 }
 
+// Close waits for all submitted tasks, and stops the workers.
 func (p *TaskPool) Close() {
-	if !p.closed {
-		p.closed = true
-		close(p.tasks)
-		p.wg.Wait()
+	p.submitLock.Lock()
+	if p.closed {
+		p.submitLock.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.tasks)
+	p.submitLock.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *TaskPool) execute(task Task) {
+	defer p.pending.Done()
+
+	p.lock.Lock()
+	p.progress.Queued--
+	if p.ctx.Err() != nil {
+		p.progress.Canceled++
+		p.lock.Unlock()
+		return
+	}
+	p.progress.Running++
+	p.lock.Unlock()
+
+	err := p.run(task)
+
+	p.lock.Lock()
+	p.progress.Running--
+	if err != nil {
+		p.progress.Failed++
+	} else {
+		p.progress.Done++
+	}
+	p.lock.Unlock()
+
+	if err != nil {
+		log.Error("❌ Task failed: %v", err)
 	}
 }
+
+func (p *TaskPool) run(task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	return task(p.ctx)
+}
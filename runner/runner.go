@@ -1,143 +1,352 @@
 package runner
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"go-experiments/brokers/backtesting"
 	"go-experiments/common"
+	"go-experiments/gridsearch"
 	"go-experiments/traders"
-	"go-experiments/traders/modular"
+	"slices"
+	"strings"
+	"sync"
 )
 
 var log = common.NewLogger("runner")
 
+// Default number of submitted runs grouped by dataset before being queued
+const defaultBatchSize = 1000
+
 type Runner struct {
-	db       *Database
+	store    Store
 	datasets *datasets
+	executor Executor
 	pool     *TaskPool
+
+	batchSize   int
+	retryFailed bool
+	pending     []*RunSpec      // Submitted runs not queued yet
+	inFlight    map[string]bool // Keys of queued or running runs
+	lock        sync.Mutex
+}
+
+type Options struct {
+	Store       Store         // Defaults to the SQLite store at output/data.db, closed with the runner
+	Loader      DatasetLoader // Defaults to HistoricalLoader
+	Executor    Executor      // Defaults to running locally, see Coordinator to run on workers
+	CacheBudget int64         // Memory budget of the dataset cache in bytes, defaults to 4 GB
+	BatchSize   int           // Number of submitted runs grouped by dataset before being queued, defaults to 1000
+	RetryFailed bool          // Run again runs which failed previously, instead of skipping them
+	Pool        PoolOptions
 }
 
 func NewRunner() (*Runner, error) {
-	db, err := OpenDatabase()
-	if err != nil {
-		return nil, err
+	return NewRunnerWithOptions(context.Background(), &Options{})
+}
+
+// NewRunnerWithLoader creates a runner which gets its datasets from the given loader, e.g. SyntheticLoader.
+func NewRunnerWithLoader(loader DatasetLoader) (*Runner, error) {
+	return NewRunnerWithOptions(context.Background(), &Options{Loader: loader})
+}
+
+// NewRunnerWithOptions creates a runner whose pending runs are skipped once ctx is canceled.
+func NewRunnerWithOptions(ctx context.Context, options *Options) (*Runner, error) {
+	store := options.Store
+	if store == nil {
+		var err error
+		if store, err = OpenStore(""); err != nil {
+			return nil, err
+		}
+	}
+
+	loader := options.Loader
+	if loader == nil {
+		loader = HistoricalLoader
+	}
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	datasets := newDatasets(loader, options.CacheBudget)
+
+	executor := options.Executor
+	if executor == nil {
+		executor = &localExecutor{datasets: datasets}
 	}
 
 	return &Runner{
-		db:       db,
-		datasets: newDatasets(),
-		pool:     NewTaskPool(),
+		store:       store,
+		datasets:    datasets,
+		executor:    executor,
+		pool:        NewTaskPool(ctx, &options.Pool),
+		batchSize:   batchSize,
+		retryFailed: options.RetryFailed,
+		inFlight:    make(map[string]bool),
 	}, nil
 }
 
+// Close queues pending runs and waits for all of them to complete.
 func (r *Runner) Close() {
+	if err := r.Flush(); err != nil {
+		log.Warning("Pending runs not queued: %v", err)
+	}
+
 	r.pool.Close()
-	r.db.Close()
+	r.store.Close()
 }
 
-func (r *Runner) SubmitRun(instrument string, month common.Month, strategy modular.Builder) error {
-	// Try to see if output is already cached
-	strategyStr := modular.ToJSON(strategy)
+// SubmitRun enqueues a run, which is skipped if it already succeeded, was pruned, failed (unless retrying failed runs)
+// or is in progress.
+//
+// Runs are queued by batches, grouped by dataset so that each month is loaded as few times as possible.
+// Blocks while the queue is full, fails once the runner context is canceled.
+func (r *Runner) SubmitRun(spec *RunSpec) error {
+	r.lock.Lock()
+	r.pending = append(r.pending, spec)
+	if len(r.pending) < r.batchSize {
+		r.lock.Unlock()
+		return nil
+	}
+	batch := r.pending
+	r.pending = nil
+	r.lock.Unlock()
 
-	run, err := r.db.FindRun(instrument, month.String(), strategyStr)
+	return r.queue(batch)
+}
+
+// Flush queues the runs submitted so far, without waiting for a full batch.
+func (r *Runner) Flush() error {
+	r.lock.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.lock.Unlock()
+
+	return r.queue(batch)
+}
+
+func (r *Runner) queue(batch []*RunSpec) error {
+	slices.SortStableFunc(batch, func(a, b *RunSpec) int {
+		return cmp.Or(
+			strings.Compare(a.Instrument, b.Instrument),
+			a.TimeRange.Begin().Compare(b.TimeRange.Begin()),
+			a.TimeRange.End().Compare(b.TimeRange.End()),
+		)
+	})
+
+	for _, spec := range batch {
+		if err := r.queueRun(spec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) queueRun(spec *RunSpec) error {
+	run, err := r.newRun(spec)
 	if err != nil {
-		return err
+		// Count it as a failed run
+		return r.pool.Submit(func(ctx context.Context) error {
+			return fmt.Errorf("failed to prepare run for %s: %w", spec, err)
+		})
 	}
 
-	if run != nil {
-		log.Info("Run already exists for %s %s: %s", instrument, month.String(), strategy.Format().Compact())
+	queue, err := r.shouldQueue(run, spec)
+	if err != nil {
+		return err
+	}
+	if !queue {
+		r.pool.Skip()
 		return nil
 	}
 
-	// enqueue run
-	r.pool.Submit(func() {
-		if err := r.run(instrument, month, strategy); err != nil {
-			log.Error("Failed to run strategy for %s %s: %v", instrument, month.String(), err)
-		}
+	if err := r.store.SetRunStatus(run, RunStatusQueued, ""); err != nil {
+		r.release(run)
+		return fmt.Errorf("failed to set run status: %w", err)
+	}
+
+	err = r.pool.Submit(func(ctx context.Context) error {
+		defer r.release(run)
+		return r.execute(ctx, run, spec)
 	})
+	if err != nil {
+		r.release(run)
+		return err
+	}
 
 	return nil
 }
 
-func (r *Runner) run(instrument string, month common.Month, strategy modular.Builder) error {
-	log.Info("Running strategy for %s %s: %s", instrument, month.String(), strategy.Format().Compact())
+// shouldQueue checks whether the run is already done or in progress, and marks it as in progress otherwise.
+func (r *Runner) shouldQueue(run *Run, spec *RunSpec) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-	dataset, err := r.datasets.Get(instrument, month)
+	if r.inFlight[run.Key] {
+		log.Info("Run already in progress for %s: %s", spec, spec.Trader.Format().Compact())
+		return false, nil
+	}
+
+	status, _, err := r.store.FindRunStatus(run.Key)
 	if err != nil {
-		return fmt.Errorf("failed to get dataset for %s %s: %w", instrument, month.String(), err)
+		return false, fmt.Errorf("failed to find run status: %w", err)
+	}
+
+	switch status {
+	case RunStatusSucceeded:
+		log.Info("Run already exists for %s: %s", spec, spec.Trader.Format().Compact())
+		return false, nil
+	case RunStatusPruned:
+		log.Info("Run previously pruned for %s: %s", spec, spec.Trader.Format().Compact())
+		return false, nil
+	case RunStatusFailed:
+		if !r.retryFailed {
+			log.Info("Run previously failed for %s: %s", spec, spec.Trader.Format().Compact())
+			return false, nil
+		}
 	}
 
-	brokerConfig := &backtesting.Config{
-		// For backtesting, we assume a lot size of 1 for simplicity.
-		// In a real broker, this would be the number of units per lot.
-		// Not that using IG broker, EUR/USD Mini has also a size of 1.
-		LotSize: 1,
+	// Queued or running runs were interrupted
+	r.inFlight[run.Key] = true
+	return true, nil
+}
+
+func (r *Runner) release(run *Run) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.inFlight, run.Key)
+}
 
-		// Leverage is the ratio of the amount of capital that a trader must put up to open a position.
-		// For example, if the leverage is 30, it means that for every 1 unit of capital,
-		// the trader can control 30 units of the asset.
-		// This is a common leverage ratio in forex trading.
-		Leverage: 30.0,
+// execute runs and records the status of the run, including panics. Pruned runs are not failures.
+func (r *Runner) execute(ctx context.Context, run *Run, spec *RunSpec) error {
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.setStatus(run, RunStatusFailed, fmt.Sprintf("panic: %v", rec))
+			panic(rec) // Recovered by the pool
+		}
+	}()
 
-		InitialCapital: 100000,
+	if err := r.store.SetRunStatus(run, RunStatusRunning, ""); err != nil {
+		return fmt.Errorf("failed to set run status: %w", err)
 	}
 
-	broker, err := backtesting.NewBroker(brokerConfig, dataset)
-	if err != nil {
-		return fmt.Errorf("failed to create broker: %w", err)
+	if err := r.run(ctx, run, spec); err != nil {
+		var aborted *backtesting.AbortedError
+		if errors.As(err, &aborted) {
+			log.Info("✂️ Run pruned for %s (%s): %s", spec, aborted, spec.Trader.Format().Compact())
+			r.setStatus(run, RunStatusPruned, aborted.Error())
+			return nil
+		}
+
+		err = fmt.Errorf("failed to run strategy for %s: %w", spec, err)
+		if ctx.Err() != nil {
+			// Interrupted, not failed: run again on resume
+			r.setStatus(run, RunStatusQueued, "")
+			return err
+		}
+		r.setStatus(run, RunStatusFailed, err.Error())
+		return err
 	}
 
-	if err := traders.SetupModularTrader(broker, strategy); err != nil {
-		return fmt.Errorf("failed to setup trader: %w", err)
+	return nil
+}
+
+func (r *Runner) setStatus(run *Run, status RunStatus, message string) {
+	if err := r.store.SetRunStatus(run, status, message); err != nil {
+		log.Error("Failed to record run status: %v", err)
 	}
-	if err := broker.Run(); err != nil {
-		return fmt.Errorf("failed to run broker: %w", err)
+}
+
+// Wait queues pending runs and waits for the runs submitted so far to complete, e.g. to read their results.
+func (r *Runner) Wait() error {
+	if err := r.Flush(); err != nil {
+		return err
 	}
 
-	metrics, err := backtesting.ComputeMetrics(broker)
+	r.pool.Wait()
+	return nil
+}
+
+// FindRun returns the stored results of the run, nil if it did not succeed.
+func (r *Runner) FindRun(spec *RunSpec) (*Run, error) {
+	run, err := r.newRun(spec)
 	if err != nil {
-		return fmt.Errorf("failed to compute metrics: %w", err)
+		return nil, err
 	}
 
-	var metrics0 *backtesting.Metrics
+	return r.store.FindRun(run.Key)
+}
 
-	switch len(metrics) {
-	case 0:
-		// No metrics means no position has been taken
-		metrics0 = &backtesting.Metrics{}
+// FindRunStatus returns the status of the run, along with the error of failed runs or the reason of pruned ones.
+func (r *Runner) FindRunStatus(spec *RunSpec) (RunStatus, string, error) {
+	run, err := r.newRun(spec)
+	if err != nil {
+		return RunStatusUnknown, "", err
+	}
 
-	case 1:
-		var ok bool
-		metrics0, ok = metrics[month]
-		if !ok {
-			return fmt.Errorf("no metrics found for month %s", month.String())
-		}
+	return r.store.FindRunStatus(run.Key)
+}
+
+// ExpectRuns announces the total number of runs which will be submitted, for the ETA of Progress.
+func (r *Runner) ExpectRuns(total int) {
+	r.pool.Expect(total)
+}
+
+func (r *Runner) Progress() Progress {
+	return r.pool.Progress()
+}
 
-	default:
-		return fmt.Errorf("expected exactly one metric, got %d", len(metrics))
+func (r *Runner) run(ctx context.Context, run *Run, spec *RunSpec) error {
+	log.Info("Running strategy for %s: %s", spec, spec.Trader.Format().Compact())
+
+	result, err := r.executor.Execute(ctx, run, spec)
+	if err != nil {
+		return err
 	}
 
-	if err := r.saveResult(instrument, month, strategy, metrics0); err != nil {
-		return fmt.Errorf("failed to save result: %w", err)
+	run.Metrics = *result.Metrics
+	if err := r.store.SaveRun(run, result.Months, result.Trades); err != nil {
+		return fmt.Errorf("failed to save run: %w", err)
 	}
 
-	log.Info("Run completed for %s %s: %s", instrument, month.String(), strategy.Format().Compact())
+	log.Info("Run completed for %s: %s", spec, spec.Trader.Format().Compact())
 	return nil
 }
 
-func (r *Runner) saveResult(instrument string, month common.Month, strategy modular.Builder, metrics *backtesting.Metrics) error {
-	strategyStr := modular.ToJSON(strategy)
+// newRun describes the run with everything which affects its results.
+func (r *Runner) newRun(spec *RunSpec) (*Run, error) {
+	brokerConfig := spec.Broker
+	if !brokerConfig.Candles {
+		brokerConfig.Intrabar = 0 // Ignored by ticks, so left out of the key
+	}
+	brokerConfigStr, err := json.Marshal(brokerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize broker config: %w", err)
+	}
 
-	run := &run{
-		Key:        r.db.ComputeKey(instrument, month.String(), strategyStr),
-		Instrument: instrument,
-		TimeRange:  month.String(),
-		Strategy:   strategyStr,
-		Metrics:    *metrics,
+	checksum, err := r.datasets.RangeChecksum(spec.Instrument, spec.TimeRange, spec.Broker.Candles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataset checksum: %w", err)
 	}
 
-	if err := r.db.SaveRun(run); err != nil {
-		return fmt.Errorf("failed to save run: %w", err)
+	run := &Run{
+		Instrument:      spec.Instrument,
+		TimeRange:       spec.TimeRange.String(),
+		Strategy:        traders.SpecToJSON(spec.Trader),
+		BrokerConfig:    string(brokerConfigStr),
+		DatasetChecksum: checksum,
+		EngineVersion:   backtesting.EngineVersion,
 	}
+	if spec.Params != nil {
+		run.Params = gridsearch.ComboToJSON(spec.Params)
+	}
+	run.Key = run.ComputeKey()
 
-	return nil
+	return run, nil
 }
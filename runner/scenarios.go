@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"go-experiments/brokers"
+	"go-experiments/brokers/backtesting"
+	"math"
+	"slices"
+)
+
+// TraderSetup registers a trader on a broker.
+type TraderSetup func(broker brokers.Broker) error
+
+type ScenarioResult struct {
+	Seed    int64
+	Metrics *backtesting.Metrics
+}
+
+// RunScenarios runs the same trader on count perturbed replays of the dataset, seeded from seed to seed+count-1.
+// Scenarios are not cached in the database.
+func RunScenarios(dataset *backtesting.Dataset, config *backtesting.Config, setup TraderSetup, scenario *backtesting.Scenario, count int, seed int64) ([]*ScenarioResult, error) {
+	results := make([]*ScenarioResult, count)
+	errs := make([]error, count)
+
+	pool := NewTaskPool(context.Background(), &PoolOptions{})
+	for i := 0; i < count; i++ {
+		err := pool.Submit(func(ctx context.Context) error {
+			scenarioSeed := seed + int64(i)
+			metrics, err := runScenario(dataset, config, setup, scenario, scenarioSeed)
+			if err != nil {
+				errs[i] = fmt.Errorf("scenario with seed %d failed: %w", scenarioSeed, err)
+				return errs[i]
+			}
+
+			results[i] = &ScenarioResult{Seed: scenarioSeed, Metrics: metrics}
+			log.Info("Scenario with seed %d completed: PnL %.2f", scenarioSeed, metrics.NetPnL)
+			return nil
+		})
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+	pool.Close()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		if results[i] == nil {
+			// The task panicked
+			return nil, fmt.Errorf("scenario with seed %d failed", seed+int64(i))
+		}
+	}
+
+	return results, nil
+}
+
+func runScenario(dataset *backtesting.Dataset, config *backtesting.Config, setup TraderSetup, scenario *backtesting.Scenario, seed int64) (*backtesting.Metrics, error) {
+	broker, err := backtesting.NewBroker(config, scenario.Apply(dataset, seed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create broker: %w", err)
+	}
+
+	if err := setup(broker); err != nil {
+		return nil, fmt.Errorf("failed to setup trader: %w", err)
+	}
+	if err := broker.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run broker: %w", err)
+	}
+
+	return backtesting.ComputeTotalMetrics(broker)
+}
+
+// Distribution summarizes the values of a metric across scenarios.
+type Distribution struct {
+	Mean   float64
+	StdDev float64
+	Min    float64
+	P5     float64
+	Median float64
+	P95    float64
+	Max    float64
+}
+
+func (d *Distribution) String() string {
+	return fmt.Sprintf("mean=%.2f, stddev=%.2f, min=%.2f, p5=%.2f, median=%.2f, p95=%.2f, max=%.2f",
+		d.Mean, d.StdDev, d.Min, d.P5, d.Median, d.P95, d.Max)
+}
+
+// NewDistribution computes the distribution of the given values.
+func NewDistribution(values []float64) *Distribution {
+	if len(values) == 0 {
+		return &Distribution{}
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(len(sorted))
+
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	if len(sorted) > 1 {
+		variance /= float64(len(sorted) - 1)
+	}
+
+	return &Distribution{
+		Mean:   mean,
+		StdDev: math.Sqrt(variance),
+		Min:    sorted[0],
+		P5:     percentile(sorted, 5),
+		Median: percentile(sorted, 50),
+		P95:    percentile(sorted, 95),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+// percentile interpolates linearly between the closest ranks of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+// ScenarioDistributions summarizes the main metrics of scenario results.
+func ScenarioDistributions(results []*ScenarioResult) map[string]*Distribution {
+	extractors := map[string]func(m *backtesting.Metrics) float64{
+		"NetPnL":         func(m *backtesting.Metrics) float64 { return m.NetPnL },
+		"TotalTrades":    func(m *backtesting.Metrics) float64 { return float64(m.TotalTrades) },
+		"WinRate":        func(m *backtesting.Metrics) float64 { return m.WinRate },
+		"ProfitFactor":   func(m *backtesting.Metrics) float64 { return m.ProfitFactor },
+		"MaxDrawdownPct": func(m *backtesting.Metrics) float64 { return m.MaxDrawdownPct },
+		"MaxDrawdown":    func(m *backtesting.Metrics) float64 { return m.MaxDrawdown },
+		"ExpectedValueR": func(m *backtesting.Metrics) float64 { return m.ExpectedValueR },
+	}
+
+	distributions := make(map[string]*Distribution, len(extractors))
+	for name, extract := range extractors {
+		values := make([]float64, len(results))
+		for i, r := range results {
+			values[i] = extract(r.Metrics)
+		}
+		distributions[name] = NewDistribution(values)
+	}
+
+	return distributions
+}
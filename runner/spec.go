@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/gridsearch"
+	"go-experiments/traders"
+)
+
+// RunSpec describes a run: everything but the dataset content which affects its results.
+type RunSpec struct {
+	Instrument string
+	TimeRange  common.TimeRange
+	Trader     traders.Spec
+
+	// Broker settings, including trading costs, stored with the results
+	Broker backtesting.Config
+
+	// Parameters the trader was built from, stored with the results for analysis (optional)
+	Params gridsearch.Combo
+}
+
+// NewRunSpec creates a run specification with the default broker settings.
+func NewRunSpec(instrument string, timeRange common.TimeRange, trader traders.Spec) *RunSpec {
+	return &RunSpec{
+		Instrument: instrument,
+		TimeRange:  timeRange,
+		Trader:     trader,
+		Broker:     DefaultBrokerConfig(),
+	}
+}
+
+func (s *RunSpec) String() string {
+	return s.Instrument + " " + s.TimeRange.String()
+}
+
+type runSpecJSON struct {
+	Instrument string             `json:"instrument"`
+	TimeRange  string             `json:"time_range"`
+	Trader     json.RawMessage    `json:"trader"`
+	Broker     backtesting.Config `json:"broker"`
+	Params     json.RawMessage    `json:"params,omitempty"`
+}
+
+// MarshalJSON serializes the run so that it can be sent to workers.
+func (s *RunSpec) MarshalJSON() ([]byte, error) {
+	raw := runSpecJSON{
+		Instrument: s.Instrument,
+		TimeRange:  s.TimeRange.String(),
+		Trader:     json.RawMessage(traders.SpecToJSON(s.Trader)),
+		Broker:     s.Broker,
+	}
+	if s.Params != nil {
+		raw.Params = json.RawMessage(gridsearch.ComboToJSON(s.Params))
+	}
+
+	return json.Marshal(raw)
+}
+
+func (s *RunSpec) UnmarshalJSON(data []byte) error {
+	var raw runSpecJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	timeRange, err := common.ParseTimeRange(raw.TimeRange)
+	if err != nil {
+		return err
+	}
+
+	trader, err := traders.SpecFromJSON(raw.Trader)
+	if err != nil {
+		return fmt.Errorf("failed to parse trader: %w", err)
+	}
+
+	var params gridsearch.Combo
+	if raw.Params != nil {
+		if params, err = gridsearch.ComboFromJSON(raw.Params); err != nil {
+			return err
+		}
+	}
+
+	*s = RunSpec{
+		Instrument: raw.Instrument,
+		TimeRange:  timeRange,
+		Trader:     trader,
+		Broker:     raw.Broker,
+		Params:     params,
+	}
+	return nil
+}
+
+func DefaultBrokerConfig() backtesting.Config {
+	return backtesting.Config{
+		// For backtesting, we assume a lot size of 1 for simplicity.
+		// In a real broker, this would be the number of units per lot.
+		// Not that using IG broker, EUR/USD Mini has also a size of 1.
+		LotSize: 1,
+
+		// Leverage is the ratio of the amount of capital that a trader must put up to open a position.
+		// For example, if the leverage is 30, it means that for every 1 unit of capital,
+		// the trader can control 30 units of the asset.
+		// This is a common leverage ratio in forex trading.
+		Leverage: 30.0,
+
+		InitialCapital: 100000,
+	}
+}
@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"crypto/md5"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/traders"
+	"strings"
+)
+
+const defaultStorePath = "output/data.db"
+
+type Run struct {
+	// Config
+	Key        string // hash of next fields
+	Instrument string
+	TimeRange  string
+	Strategy   string // JSON of traders.Spec
+	Params     string // JSON of the gridsearch.Combo the strategy was built from, if any (not part of the key)
+
+	// Reproducibility
+	BrokerConfig    string // JSON of backtesting.Config
+	DatasetChecksum string
+	EngineVersion   int
+
+	// Results
+	backtesting.Metrics
+}
+
+// ComputeKey hashes everything which affects the results of the run.
+func (r *Run) ComputeKey() string {
+	hash := md5.New()
+	hash.Write([]byte(fmt.Sprintf("%s:%s:%s:%s:%s:%d", r.Instrument, r.TimeRange, r.Strategy, r.BrokerConfig, r.DatasetChecksum, r.EngineVersion)))
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+type RunStatus string
+
+const (
+	RunStatusUnknown   RunStatus = "" // Never submitted
+	RunStatusQueued    RunStatus = "queued"
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusPruned    RunStatus = "pruned" // Stopped early by an abort rule of the broker config, the message being the reason
+)
+
+// Trader parses the trader of the run.
+func (r *Run) Trader() (traders.Spec, error) {
+	return traders.SpecFromJSON([]byte(r.Strategy))
+}
+
+// Store persists the results of runs.
+type Store interface {
+	// FindRun returns nil if the run does not exist
+	FindRun(key string) (*Run, error)
+
+	// FindRunStatus returns the status of the run, along with the error of failed runs.
+	FindRunStatus(key string) (RunStatus, string, error)
+
+	// SetRunStatus records the progress of the run. Use SaveRun instead to mark it as succeeded.
+	SetRunStatus(r *Run, status RunStatus, message string) error
+
+	// FindRunMonths returns the per-month breakdown of a run.
+	FindRunMonths(key string) (map[common.Month]*backtesting.Metrics, error)
+
+	// SaveRun saves the aggregate metrics of the run, along with its per-month breakdown and its trades,
+	// and marks it as succeeded.
+	SaveRun(r *Run, months map[common.Month]*backtesting.Metrics, trades []*backtesting.Trade) error
+
+	// ForEachRun calls fn with each saved run and its per-month breakdown, in key order, e.g. for reports.
+	// It stops at the first error returned by fn.
+	ForEachRun(fn func(r *Run, months map[common.Month]*backtesting.Metrics) error) error
+
+	Close() error
+}
+
+// OpenStore opens a store from its description:
+// - "sqlite:output/data.db" (or just a path ending with .db)
+// - "csv:output/results" (directory of CSV files)
+// - "memory"
+func OpenStore(spec string) (Store, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+
+	switch {
+	case spec == "":
+		return OpenSQLiteStore(defaultStorePath)
+	case kind == "sqlite":
+		return OpenSQLiteStore(path)
+	case kind == "csv":
+		return OpenCSVStore(path)
+	case kind == "memory":
+		return NewMemoryStore(), nil
+	case strings.HasSuffix(spec, ".db"):
+		return OpenSQLiteStore(spec)
+	default:
+		return nil, fmt.Errorf("invalid store '%s': expected sqlite:<path>, csv:<dir> or memory", spec)
+	}
+}
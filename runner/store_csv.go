@@ -0,0 +1,544 @@
+package runner
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	csvRunsHeader   = append([]string{"key", "instrument", "time_range", "strategy", "params", "broker_config", "dataset_checksum", "engine_version"}, csvMetricsHeader...)
+	csvMonthsHeader = append([]string{"run_key", "month"}, csvMetricsHeader...)
+	csvStatusHeader = []string{"key", "instrument", "time_range", "strategy", "status", "error", "updated_at"}
+	csvTradesHeader = []string{"run_key", "direction", "quantity", "open_time", "open_price", "close_time", "close_price", "stop_loss", "take_profit", "exit_reason", "pnl"}
+
+	csvMetricsHeader = []string{"total_trades", "win_rate", "net_pnl", "profit_factor", "max_drawdown_pct", "max_drawdown", "expected_value_r", "avg_trade_duration_seconds", "long_trades", "short_trades"}
+)
+
+// CSVStore appends results to CSV files in a directory (runs.csv, run_months.csv, trades.csv, run_status.csv),
+// with the same columns as the SQLite tables, so that they can be loaded directly with pandas or duckdb.
+//
+// Files are append only: rows of a run are written run last, so that a run interrupted while saving is run again.
+// Month and trade rows left by such interruptions, or by saving a run again, are dropped when the store is opened, only
+// the rows of the last save of each saved run being kept. The status of a run is its last row in run_status.csv.
+type CSVStore struct {
+	index  *MemoryStore // Runs loaded from files and saved since, for lookups (without trades)
+	runs   *csvFile
+	months *csvFile
+	trades *csvFile
+	status *csvFile
+	lock   sync.Mutex
+}
+
+var _ Store = (*CSVStore)(nil)
+
+type csvFile struct {
+	path   string
+	file   *os.File
+	writer *csv.Writer
+}
+
+func OpenCSVStore(dir string) (*CSVStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	store := &CSVStore{index: NewMemoryStore()}
+
+	var monthRecords, tradeRecords, runRecords, statusRecords [][]string
+	var err error
+
+	if store.months, monthRecords, err = openCSVFile(filepath.Join(dir, "run_months.csv"), csvMonthsHeader); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if store.trades, tradeRecords, err = openCSVFile(filepath.Join(dir, "trades.csv"), csvTradesHeader); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if store.runs, runRecords, err = openCSVFile(filepath.Join(dir, "runs.csv"), csvRunsHeader); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	if store.status, statusRecords, err = openCSVFile(filepath.Join(dir, "run_status.csv"), csvStatusHeader); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// Keep the months and trades of the last save of each saved run: a save writes every month of the run once, and
+	// as many trades as the run has
+	tradeCounts := make(map[string]int, len(runRecords))
+	for _, record := range runRecords {
+		metrics, err := parseCSVMetrics(record[len(csvRunsHeader)-len(csvMetricsHeader):])
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		tradeCounts[record[0]] = metrics.TotalTrades
+	}
+	savedMonths := make(map[[2]string]bool)
+	monthRecords, err = store.months.compact(csvMonthsHeader, monthRecords, func(record []string) bool {
+		_, saved := tradeCounts[record[0]]
+		month := [2]string{record[0], record[1]}
+		keep := saved && !savedMonths[month]
+		savedMonths[month] = true
+		return keep
+	})
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	tradeRecords, err = store.trades.compact(csvTradesHeader, tradeRecords, func(record []string) bool {
+		tradeCounts[record[0]]--
+		return tradeCounts[record[0]] >= 0
+	})
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	if err := store.load(runRecords, monthRecords, tradeRecords, statusRecords); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *CSVStore) load(runRecords, monthRecords, tradeRecords, statusRecords [][]string) error {
+	months := make(map[string]map[common.Month]*backtesting.Metrics)
+	for _, record := range monthRecords {
+		month, err := common.ParseMonth(record[1])
+		if err != nil {
+			return err
+		}
+		metrics, err := parseCSVMetrics(record[2:])
+		if err != nil {
+			return err
+		}
+
+		if months[record[0]] == nil {
+			months[record[0]] = make(map[common.Month]*backtesting.Metrics)
+		}
+		months[record[0]][month] = metrics
+	}
+
+	runs := make([]*Run, 0, len(runRecords))
+	for _, record := range runRecords {
+		engineVersion, err := strconv.Atoi(record[7])
+		if err != nil {
+			return fmt.Errorf("invalid engine version '%s': %w", record[7], err)
+		}
+		metrics, err := parseCSVMetrics(record[8:])
+		if err != nil {
+			return err
+		}
+
+		r := &Run{
+			Key:             record[0],
+			Instrument:      record[1],
+			TimeRange:       record[2],
+			Strategy:        record[3],
+			Params:          record[4],
+			BrokerConfig:    record[5],
+			DatasetChecksum: record[6],
+			EngineVersion:   engineVersion,
+			Metrics:         *metrics,
+		}
+		runs = append(runs, r)
+	}
+
+	if err := backfillDrawdowns(runs, months, tradeRecords); err != nil {
+		return err
+	}
+
+	for _, r := range runs {
+		if err := s.index.SaveRun(r, months[r.Key], nil); err != nil {
+			return err
+		}
+	}
+
+	// Only the key is needed to update the status in the index
+	for _, record := range statusRecords {
+		s.index.status[record[0]] = &runState{status: RunStatus(record[4]), message: record[5]}
+	}
+
+	return nil
+}
+
+// backfillDrawdowns computes the max drawdown of runs saved before the column was added from their trades, like
+// backtesting.Metrics.MaxDrawdown: closed-trade equity in opening order from 0, for the run and for each month of
+// opening. Runs missing trades keep NaN.
+func backfillDrawdowns(runs []*Run, months map[string]map[common.Month]*backtesting.Metrics, tradeRecords [][]string) error {
+	type curves struct {
+		trades int
+		run    drawdown
+		months map[common.Month]*drawdown
+	}
+
+	missing := make(map[string]*curves)
+	for _, r := range runs {
+		if math.IsNaN(r.MaxDrawdown) {
+			missing[r.Key] = &curves{months: make(map[common.Month]*drawdown)}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, record := range tradeRecords {
+		c := missing[record[0]]
+		if c == nil {
+			continue
+		}
+
+		openTime, err := time.Parse(time.RFC3339Nano, record[3])
+		if err != nil {
+			return fmt.Errorf("invalid trade open time '%s': %w", record[3], err)
+		}
+		pnl, err := strconv.ParseFloat(record[10], 64)
+		if err != nil {
+			return fmt.Errorf("invalid trade PnL '%s': %w", record[10], err)
+		}
+
+		month := common.FromDate(openTime)
+		if c.months[month] == nil {
+			c.months[month] = &drawdown{}
+		}
+		c.trades++
+		c.run.add(pnl)
+		c.months[month].add(pnl)
+	}
+
+	backfilled := 0
+	for _, r := range runs {
+		c := missing[r.Key]
+		if c == nil || c.trades != r.TotalTrades {
+			continue
+		}
+
+		r.MaxDrawdown = c.run.max
+		for month, m := range months[r.Key] {
+			if d := c.months[month]; d != nil {
+				m.MaxDrawdown = d.max
+			} else {
+				m.MaxDrawdown = 0 // No closed trade
+			}
+		}
+		backfilled++
+	}
+
+	log.Info("📉 Computed the max drawdown of %d of %d runs saved without it", backfilled, len(missing))
+	return nil
+}
+
+// drawdown follows the largest drop of closed-trade equity from its peak, the initial capital being the first peak.
+type drawdown struct {
+	equity, peak, max float64
+}
+
+func (d *drawdown) add(pnl float64) {
+	d.equity += pnl
+	d.peak = max(d.peak, d.equity)
+	d.max = max(d.max, d.peak-d.equity)
+}
+
+// FindRun implements Store.
+func (s *CSVStore) FindRun(key string) (*Run, error) {
+	return s.index.FindRun(key)
+}
+
+// FindRunMonths implements Store.
+func (s *CSVStore) FindRunMonths(key string) (map[common.Month]*backtesting.Metrics, error) {
+	return s.index.FindRunMonths(key)
+}
+
+// ForEachRun implements Store.
+func (s *CSVStore) ForEachRun(fn func(r *Run, months map[common.Month]*backtesting.Metrics) error) error {
+	return s.index.ForEachRun(fn)
+}
+
+// SaveRun implements Store.
+func (s *CSVStore) SaveRun(r *Run, months map[common.Month]*backtesting.Metrics, trades []*backtesting.Trade) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := r.ComputeKey()
+
+	for month, m := range months {
+		if err := s.months.writer.Write(append([]string{key, month.String()}, formatCSVMetrics(m)...)); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range trades {
+		record := []string{
+			key, t.Direction.String(), strconv.Itoa(t.Quantity),
+			t.OpenTime.Format(time.RFC3339Nano), formatCSVFloat(t.OpenPrice),
+			t.CloseTime.Format(time.RFC3339Nano), formatCSVFloat(t.ClosePrice),
+			formatCSVFloat(t.StopLoss), formatCSVFloat(t.TakeProfit),
+			t.ExitReason.String(), formatCSVFloat(t.PnL),
+		}
+		if err := s.trades.writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if err := s.months.flush(); err != nil {
+		return err
+	}
+	if err := s.trades.flush(); err != nil {
+		return err
+	}
+
+	record := append([]string{
+		key, r.Instrument, r.TimeRange, r.Strategy, r.Params,
+		r.BrokerConfig, r.DatasetChecksum, strconv.Itoa(r.EngineVersion),
+	}, formatCSVMetrics(&r.Metrics)...)
+
+	if err := s.runs.writer.Write(record); err != nil {
+		return err
+	}
+	if err := s.runs.flush(); err != nil {
+		return err
+	}
+
+	if err := s.writeStatus(key, r, RunStatusSucceeded, ""); err != nil {
+		return err
+	}
+
+	return s.index.SaveRun(r, months, nil)
+}
+
+// FindRunStatus implements Store.
+func (s *CSVStore) FindRunStatus(key string) (RunStatus, string, error) {
+	return s.index.FindRunStatus(key)
+}
+
+// SetRunStatus implements Store.
+func (s *CSVStore) SetRunStatus(r *Run, status RunStatus, message string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.writeStatus(r.ComputeKey(), r, status, message); err != nil {
+		return err
+	}
+
+	return s.index.SetRunStatus(r, status, message)
+}
+
+func (s *CSVStore) writeStatus(key string, r *Run, status RunStatus, message string) error {
+	record := []string{key, r.Instrument, r.TimeRange, r.Strategy, string(status), message, time.Now().UTC().Format(time.RFC3339Nano)}
+	if err := s.status.writer.Write(record); err != nil {
+		return err
+	}
+	return s.status.flush()
+}
+
+// Close implements Store.
+func (s *CSVStore) Close() error {
+	var errs []error
+	for _, f := range []*csvFile{s.runs, s.months, s.trades, s.status} {
+		if f != nil {
+			errs = append(errs, f.file.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openCSVFile opens the file for appending, and returns its existing records (without header).
+// Files written before columns were added are upgraded, with empty values in the new columns.
+func openCSVFile(path string, header []string) (*csvFile, [][]string, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	f := &csvFile{path: path, file: file, writer: csv.NewWriter(file)}
+
+	reader := csv.NewReader(file)
+	existingHeader, err := reader.Read()
+	if err == io.EOF {
+		if err := f.writer.Write(header); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		if err := f.flush(); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return f, nil, nil
+	} else if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if slices.Equal(existingHeader, header) {
+		return f, records, nil
+	}
+
+	file.Close()
+	if records, err = upgradeCSVFile(path, existingHeader, header, records); err != nil {
+		return nil, nil, err
+	}
+
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return &csvFile{path: path, file: file, writer: csv.NewWriter(file)}, records, nil
+}
+
+// compact rewrites the file with the records kept, keep being called from the last record to the first, e.g. to drop
+// the rows of saves interrupted before their run row, or repeated.
+func (f *csvFile) compact(header []string, records [][]string, keep func(record []string) bool) ([][]string, error) {
+	kept := make([][]string, 0, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		if keep(records[i]) {
+			kept = append(kept, records[i])
+		}
+	}
+	if len(kept) == len(records) {
+		return records, nil
+	}
+	slices.Reverse(kept)
+
+	f.file.Close()
+	if err := rewriteCSVFile(f.path, header, kept); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+	f.file, f.writer = file, csv.NewWriter(file)
+
+	log.Warning("🧹 Dropped %d rows of interrupted or repeated saves from %s", len(records)-len(kept), f.path)
+	return kept, nil
+}
+
+// upgradeCSVFile rewrites the file with the columns of header, and returns the upgraded records.
+// Columns can only be added, not removed.
+func upgradeCSVFile(path string, existingHeader, header []string, records [][]string) ([][]string, error) {
+	positions := make([]int, len(header)) // Position of each column in existing records, -1 if new
+	for i, column := range header {
+		positions[i] = slices.Index(existingHeader, column)
+	}
+	for _, column := range existingHeader {
+		if !slices.Contains(header, column) {
+			return nil, fmt.Errorf("unexpected columns in %s: %v", path, existingHeader)
+		}
+	}
+
+	upgraded := make([][]string, len(records))
+	for r, record := range records {
+		upgraded[r] = make([]string, len(header))
+		for i, position := range positions {
+			if position >= 0 {
+				upgraded[r][i] = record[position]
+			}
+		}
+	}
+
+	if err := rewriteCSVFile(path, header, upgraded); err != nil {
+		return nil, fmt.Errorf("failed to upgrade %s: %w", path, err)
+	}
+
+	log.Info("🗄️  Upgraded %s with columns %v", path, header)
+	return upgraded, nil
+}
+
+// rewriteCSVFile replaces the content of the file, writing a copy first so that the file is never left half written.
+func rewriteCSVFile(path string, header []string, records [][]string) error {
+	tmpPath := path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(tmp)
+	writer.Write(header)
+	writer.WriteAll(records) // Flushes
+	if err := errors.Join(writer.Error(), tmp.Close()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (f *csvFile) flush() error {
+	f.writer.Flush()
+	return f.writer.Error()
+}
+
+func formatCSVFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func formatCSVMetrics(m *backtesting.Metrics) []string {
+	return []string{
+		strconv.Itoa(m.TotalTrades), formatCSVFloat(m.WinRate), formatCSVFloat(m.NetPnL),
+		formatCSVFloat(m.ProfitFactor), formatCSVFloat(m.MaxDrawdownPct), formatCSVFloat(m.MaxDrawdown),
+		formatCSVFloat(m.ExpectedValueR), strconv.FormatInt(int64(m.AvgTradeDuration.Seconds()), 10),
+		strconv.Itoa(m.LongTrades), strconv.Itoa(m.ShortTrades),
+	}
+}
+
+func parseCSVMetrics(fields []string) (*backtesting.Metrics, error) {
+	var m backtesting.Metrics
+	var tradeDurationSeconds int64
+	var err error
+
+	parseInt := func(s string) int {
+		var value int
+		if err == nil {
+			value, err = strconv.Atoi(s)
+		}
+		return value
+	}
+	parseFloat := func(s string) float64 {
+		var value float64
+		if err == nil {
+			value, err = strconv.ParseFloat(s, 64)
+		}
+		return value
+	}
+
+	m.TotalTrades = parseInt(fields[0])
+	m.WinRate = parseFloat(fields[1])
+	m.NetPnL = parseFloat(fields[2])
+	m.ProfitFactor = parseFloat(fields[3])
+	m.MaxDrawdownPct = parseFloat(fields[4])
+	m.MaxDrawdown = math.NaN() // Empty in rows written before the column was added
+	if fields[5] != "" {
+		m.MaxDrawdown = parseFloat(fields[5])
+	}
+	m.ExpectedValueR = parseFloat(fields[6])
+	tradeDurationSeconds = int64(parseInt(fields[7]))
+	m.LongTrades = parseInt(fields[8])
+	m.ShortTrades = parseInt(fields[9])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics %v: %w", fields, err)
+	}
+
+	m.AvgTradeDuration = time.Second * time.Duration(tradeDurationSeconds)
+	return &m, nil
+}
@@ -0,0 +1,139 @@
+package runner
+
+import (
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"slices"
+	"sync"
+)
+
+// MemoryStore keeps results in memory only, e.g. for tests or throwaway experiments.
+type MemoryStore struct {
+	runs   map[string]*Run
+	months map[string]map[common.Month]*backtesting.Metrics
+	trades map[string][]*backtesting.Trade
+	status map[string]*runState
+	lock   sync.Mutex
+}
+
+type runState struct {
+	status  RunStatus
+	message string
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		runs:   make(map[string]*Run),
+		months: make(map[string]map[common.Month]*backtesting.Metrics),
+		trades: make(map[string][]*backtesting.Trade),
+		status: make(map[string]*runState),
+	}
+}
+
+// FindRun implements Store.
+func (s *MemoryStore) FindRun(key string) (*Run, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.runs[key]
+	if !ok {
+		return nil, nil
+	}
+
+	found := *r
+	return &found, nil
+}
+
+// FindRunMonths implements Store.
+func (s *MemoryStore) FindRunMonths(key string) (map[common.Month]*backtesting.Metrics, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	months := make(map[common.Month]*backtesting.Metrics)
+	for month, m := range s.months[key] {
+		metrics := *m
+		months[month] = &metrics
+	}
+
+	return months, nil
+}
+
+// SaveRun implements Store.
+func (s *MemoryStore) SaveRun(r *Run, months map[common.Month]*backtesting.Metrics, trades []*backtesting.Trade) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	run := *r
+	run.Key = r.ComputeKey()
+	s.runs[run.Key] = &run
+
+	monthsCopy := make(map[common.Month]*backtesting.Metrics, len(months))
+	for month, m := range months {
+		metrics := *m
+		monthsCopy[month] = &metrics
+	}
+	s.months[run.Key] = monthsCopy
+
+	s.trades[run.Key] = append([]*backtesting.Trade(nil), trades...)
+	s.status[run.Key] = &runState{status: RunStatusSucceeded}
+
+	return nil
+}
+
+// ForEachRun implements Store.
+func (s *MemoryStore) ForEachRun(fn func(r *Run, months map[common.Month]*backtesting.Metrics) error) error {
+	s.lock.Lock()
+	keys := make([]string, 0, len(s.runs))
+	for key := range s.runs {
+		keys = append(keys, key)
+	}
+	s.lock.Unlock()
+
+	slices.Sort(keys)
+
+	// Copies are passed to fn without holding the lock, so that it can use the store
+	for _, key := range keys {
+		r, err := s.FindRun(key)
+		if err != nil {
+			return err
+		}
+		months, err := s.FindRunMonths(key)
+		if err != nil {
+			return err
+		}
+		if err := fn(r, months); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindRunStatus implements Store.
+func (s *MemoryStore) FindRunStatus(key string) (RunStatus, string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	state, ok := s.status[key]
+	if !ok {
+		return RunStatusUnknown, "", nil
+	}
+
+	return state.status, state.message, nil
+}
+
+// SetRunStatus implements Store.
+func (s *MemoryStore) SetRunStatus(r *Run, status RunStatus, message string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status[r.ComputeKey()] = &runState{status: status, message: message}
+	return nil
+}
+
+// Close implements Store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
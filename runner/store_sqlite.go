@@ -0,0 +1,359 @@
+package runner
+
+import (
+	"database/sql"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore stores results in a SQLite database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db}, nil
+}
+
+// Close implements Store.
+func (db *SQLiteStore) Close() error {
+	return db.db.Close()
+}
+
+// Columns of runs read by scanRun
+const runColumns = `
+        key, instrument, time_range, strategy, params,
+        broker_config, dataset_checksum, engine_version,
+        total_trades, win_rate, net_pnl,
+        profit_factor, max_drawdown_pct, max_drawdown,
+        expected_value_r, avg_trade_duration_seconds,
+        long_trades, short_trades`
+
+// Columns of run_months read by scanMonth
+const monthColumns = `
+        month,
+        total_trades, win_rate, net_pnl,
+        profit_factor, max_drawdown_pct, max_drawdown,
+        expected_value_r, avg_trade_duration_seconds,
+        long_trades, short_trades`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRun(row scanner) (*Run, error) {
+	var r Run
+	var tradeDurationSeconds int64
+	var maxDrawdown sql.NullFloat64
+
+	err := row.Scan(
+		&r.Key, &r.Instrument, &r.TimeRange, &r.Strategy, &r.Params,
+		&r.BrokerConfig, &r.DatasetChecksum, &r.EngineVersion,
+		&r.TotalTrades, &r.WinRate, &r.NetPnL,
+		&r.ProfitFactor, &r.MaxDrawdownPct, &maxDrawdown,
+		&r.ExpectedValueR, &tradeDurationSeconds,
+		&r.LongTrades, &r.ShortTrades,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r.AvgTradeDuration = time.Second * time.Duration(tradeDurationSeconds)
+	r.MaxDrawdown = floatOrNaN(maxDrawdown)
+
+	return &r, nil
+}
+
+func scanMonth(row scanner, extra ...any) (common.Month, *backtesting.Metrics, error) {
+	var monthStr string
+	var m backtesting.Metrics
+	var tradeDurationSeconds int64
+	var maxDrawdown sql.NullFloat64
+
+	err := row.Scan(append([]any{
+		&monthStr,
+		&m.TotalTrades, &m.WinRate, &m.NetPnL,
+		&m.ProfitFactor, &m.MaxDrawdownPct, &maxDrawdown,
+		&m.ExpectedValueR, &tradeDurationSeconds,
+		&m.LongTrades, &m.ShortTrades,
+	}, extra...)...)
+	if err != nil {
+		return common.Month{}, nil, err
+	}
+
+	month, err := common.ParseMonth(monthStr)
+	if err != nil {
+		return common.Month{}, nil, err
+	}
+
+	m.AvgTradeDuration = time.Second * time.Duration(tradeDurationSeconds)
+	m.MaxDrawdown = floatOrNaN(maxDrawdown)
+
+	return month, &m, nil
+}
+
+// FindRun implements Store.
+func (db *SQLiteStore) FindRun(key string) (*Run, error) {
+	r, err := scanRun(db.db.QueryRow(`SELECT `+runColumns+` FROM runs WHERE key = ?;`, key))
+	if err == sql.ErrNoRows {
+		return nil, nil // Run does not exist
+	}
+	return r, err
+}
+
+// SaveRun implements Store.
+func (db *SQLiteStore) SaveRun(r *Run, months map[common.Month]*backtesting.Metrics, trades []*backtesting.Trade) error {
+	key := r.ComputeKey()
+	tradeDurationSeconds := int64(r.AvgTradeDuration.Seconds())
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Insert or update the run
+	query := `
+    INSERT INTO runs (
+        key, instrument, time_range, strategy, params,
+        broker_config, dataset_checksum, engine_version,
+        total_trades, win_rate, net_pnl,
+        profit_factor, max_drawdown_pct, max_drawdown,
+        expected_value_r, avg_trade_duration_seconds,
+        long_trades, short_trades
+    ) VALUES (?, ?, ?, ?, ?,
+        ?, ?, ?,
+        ?, ?, ?,
+        ?, ?, ?,
+        ?, ?,
+        ?, ?
+    );`
+
+	_, err = tx.Exec(query, key, r.Instrument, r.TimeRange, r.Strategy, r.Params,
+		r.BrokerConfig, r.DatasetChecksum, r.EngineVersion,
+		r.TotalTrades, r.WinRate, r.NetPnL,
+		r.ProfitFactor, r.MaxDrawdownPct, nullFloat(r.MaxDrawdown),
+		r.ExpectedValueR, tradeDurationSeconds,
+		r.LongTrades, r.ShortTrades,
+	)
+	if err != nil {
+		return err
+	}
+
+	monthQuery := `
+    INSERT INTO run_months (
+        run_key, month,
+        total_trades, win_rate, net_pnl,
+        profit_factor, max_drawdown_pct, max_drawdown,
+        expected_value_r, avg_trade_duration_seconds,
+        long_trades, short_trades
+    ) VALUES (?, ?,
+        ?, ?, ?,
+        ?, ?, ?,
+        ?, ?,
+        ?, ?
+    );`
+
+	for month, m := range months {
+		_, err = tx.Exec(monthQuery, key, month.String(),
+			m.TotalTrades, m.WinRate, m.NetPnL,
+			m.ProfitFactor, m.MaxDrawdownPct, nullFloat(m.MaxDrawdown),
+			m.ExpectedValueR, int64(m.AvgTradeDuration.Seconds()),
+			m.LongTrades, m.ShortTrades,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	tradeQuery := `
+    INSERT INTO trades (
+        run_key, direction, quantity,
+        open_time, open_price,
+        close_time, close_price,
+        stop_loss, take_profit,
+        exit_reason, pnl
+    ) VALUES (?, ?, ?,
+        ?, ?,
+        ?, ?,
+        ?, ?,
+        ?, ?
+    );`
+
+	stmt, err := tx.Prepare(tradeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range trades {
+		_, err = stmt.Exec(key, t.Direction.String(), t.Quantity,
+			t.OpenTime, t.OpenPrice,
+			t.CloseTime, t.ClosePrice,
+			t.StopLoss, t.TakeProfit,
+			t.ExitReason.String(), t.PnL,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := setRunStatus(tx, key, r, RunStatusSucceeded, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindRunStatus implements Store.
+func (db *SQLiteStore) FindRunStatus(key string) (RunStatus, string, error) {
+	var status RunStatus
+	var message string
+
+	err := db.db.QueryRow(`SELECT status, error FROM run_status WHERE key = ?;`, key).Scan(&status, &message)
+	if err == sql.ErrNoRows {
+		return RunStatusUnknown, "", nil
+	} else if err != nil {
+		return RunStatusUnknown, "", err
+	}
+
+	return status, message, nil
+}
+
+// SetRunStatus implements Store.
+func (db *SQLiteStore) SetRunStatus(r *Run, status RunStatus, message string) error {
+	return setRunStatus(db.db, r.ComputeKey(), r, status, message)
+}
+
+// Common interface of sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func setRunStatus(db execer, key string, r *Run, status RunStatus, message string) error {
+	query := `
+    INSERT INTO run_status (
+        key, instrument, time_range, strategy,
+        status, error, updated_at
+    ) VALUES (?, ?, ?, ?,
+        ?, ?, ?
+    )
+    ON CONFLICT (key) DO UPDATE SET
+        status = excluded.status,
+        error = excluded.error,
+        updated_at = excluded.updated_at;`
+
+	_, err := db.Exec(query, key, r.Instrument, r.TimeRange, r.Strategy,
+		string(status), message, time.Now().UTC(),
+	)
+	return err
+}
+
+// FindRunMonths implements Store.
+func (db *SQLiteStore) FindRunMonths(key string) (map[common.Month]*backtesting.Metrics, error) {
+	rows, err := db.db.Query(`SELECT `+monthColumns+` FROM run_months WHERE run_key = ?;`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	months := make(map[common.Month]*backtesting.Metrics)
+	for rows.Next() {
+		month, m, err := scanMonth(rows)
+		if err != nil {
+			return nil, err
+		}
+		months[month] = m
+	}
+
+	return months, rows.Err()
+}
+
+// ForEachRun implements Store.
+func (db *SQLiteStore) ForEachRun(fn func(r *Run, months map[common.Month]*backtesting.Metrics) error) error {
+	runs, err := db.db.Query(`SELECT ` + runColumns + ` FROM runs ORDER BY key;`)
+	if err != nil {
+		return err
+	}
+	defer runs.Close()
+
+	// Both tables are read in key order, so that months are matched to their run without loading them all
+	monthRows, err := db.db.Query(`SELECT ` + monthColumns + `, run_key FROM run_months ORDER BY run_key;`)
+	if err != nil {
+		return err
+	}
+	defer monthRows.Close()
+
+	var monthKey string
+	var month common.Month
+	var metrics *backtesting.Metrics
+	nextMonth := func() error {
+		monthKey, metrics = "", nil
+		if !monthRows.Next() {
+			return monthRows.Err()
+		}
+		month, metrics, err = scanMonth(monthRows, &monthKey)
+		return err
+	}
+	if err := nextMonth(); err != nil {
+		return err
+	}
+
+	for runs.Next() {
+		r, err := scanRun(runs)
+		if err != nil {
+			return err
+		}
+
+		months := make(map[common.Month]*backtesting.Metrics)
+		for metrics != nil && monthKey <= r.Key {
+			if monthKey == r.Key {
+				months[month] = metrics
+			}
+			if err := nextMonth(); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(r, months); err != nil {
+			return err
+		}
+	}
+
+	return runs.Err()
+}
+
+// nullFloat stores NaN (unknown values) as NULL, since SQLite does not store NaN.
+func nullFloat(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: !math.IsNaN(value)}
+}
+
+func floatOrNaN(value sql.NullFloat64) float64 {
+	if !value.Valid {
+		return math.NaN()
+	}
+	return value.Float64
+}
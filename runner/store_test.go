@@ -0,0 +1,307 @@
+package runner_test
+
+import (
+	"bufio"
+	"database/sql"
+	"go-experiments/brokers"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/runner"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stores opens each store kind of the contract, the file ones in a fresh directory.
+var stores = map[string]func(t *testing.T) runner.Store{
+	"memory": func(t *testing.T) runner.Store { return runner.NewMemoryStore() },
+	"csv": func(t *testing.T) runner.Store {
+		store, err := runner.OpenCSVStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+	"sqlite": func(t *testing.T) runner.Store {
+		store, err := runner.OpenSQLiteStore(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+}
+
+func testRun(instrument string, netPnL float64) (*runner.Run, map[common.Month]*backtesting.Metrics, []*backtesting.Trade) {
+	r := &runner.Run{
+		Instrument:      instrument,
+		TimeRange:       "2023-01..2023-02",
+		Strategy:        `{"name":"test"}`,
+		Params:          `{"period":20}`,
+		BrokerConfig:    `{"InitialCapital":10000}`,
+		DatasetChecksum: "checksum",
+		EngineVersion:   1,
+		Metrics:         testMetrics(netPnL),
+	}
+	months := map[common.Month]*backtesting.Metrics{
+		common.NewMonth(2023, 1): new(backtesting.Metrics),
+		common.NewMonth(2023, 2): new(backtesting.Metrics),
+	}
+	*months[common.NewMonth(2023, 1)] = testMetrics(netPnL / 2)
+	*months[common.NewMonth(2023, 2)] = testMetrics(netPnL / 2)
+
+	open := time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC)
+	trades := []*backtesting.Trade{{
+		Direction: brokers.PositionDirectionLong, Quantity: 1000,
+		OpenTime: open, OpenPrice: 1.05, CloseTime: open.Add(time.Hour), ClosePrice: 1.06,
+		StopLoss: 1.04, TakeProfit: 1.07, PnL: netPnL,
+	}}
+	r.TotalTrades = len(trades) // Saves are told apart by the trade count
+	return r, months, trades
+}
+
+func testMetrics(netPnL float64) backtesting.Metrics {
+	return backtesting.Metrics{
+		TotalTrades: 4, WinRate: 50, NetPnL: netPnL, ProfitFactor: 1.5, MaxDrawdownPct: 2.5, MaxDrawdown: 250,
+		ExpectedValueR: 0.25, AvgTradeDuration: 90 * time.Minute, LongTrades: 3, ShortTrades: 1,
+	}
+}
+
+func TestStoreContract(t *testing.T) {
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			defer store.Close()
+
+			a, aMonths, aTrades := testRun("EURUSD", 100)
+			b, bMonths, bTrades := testRun("GBPUSD", -50)
+			key := a.ComputeKey()
+
+			if found, err := store.FindRun(key); err != nil || found != nil {
+				t.Fatalf("found run %v before saving it, error %v", found, err)
+			}
+			if status, _, err := store.FindRunStatus(key); err != nil || status != runner.RunStatusUnknown {
+				t.Fatalf("status %q before saving the run, error %v", status, err)
+			}
+
+			if err := store.SetRunStatus(a, runner.RunStatusFailed, "boom"); err != nil {
+				t.Fatal(err)
+			}
+			if status, message, err := store.FindRunStatus(key); err != nil || status != runner.RunStatusFailed || message != "boom" {
+				t.Fatalf("got status %q %q after failure, error %v", status, message, err)
+			}
+
+			for _, save := range []struct {
+				r      *runner.Run
+				months map[common.Month]*backtesting.Metrics
+				trades []*backtesting.Trade
+			}{{b, bMonths, bTrades}, {a, aMonths, aTrades}} {
+				if err := store.SaveRun(save.r, save.months, save.trades); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checkRun(t, store, a, aMonths)
+			checkRun(t, store, b, bMonths)
+			if status, message, err := store.FindRunStatus(key); err != nil || status != runner.RunStatusSucceeded || message != "" {
+				t.Fatalf("got status %q %q after saving, error %v", status, message, err)
+			}
+
+			var keys []string
+			err := store.ForEachRun(func(r *runner.Run, months map[common.Month]*backtesting.Metrics) error {
+				if len(months) != 2 {
+					t.Errorf("run %s has %d months, expected 2", r.Key, len(months))
+				}
+				keys = append(keys, r.Key)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != 2 || keys[0] >= keys[1] {
+				t.Fatalf("expected both runs in key order, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestCSVStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := runner.OpenCSVStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, aMonths, aTrades := testRun("EURUSD", 100)
+	b, bMonths, bTrades := testRun("GBPUSD", -50)
+	for range 2 { // A duplicate save, as a retry would do
+		if err := store.SaveRun(a, aMonths, aTrades); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveRun(b, bMonths, bTrades); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// A save interrupted before its run row
+	orphan := strings.Repeat("0", 32)
+	appendOrphanRows(t, filepath.Join(dir, "run_months.csv"), a.ComputeKey(), orphan)
+	appendOrphanRows(t, filepath.Join(dir, "trades.csv"), a.ComputeKey(), orphan)
+
+	if store, err = runner.OpenCSVStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	checkRun(t, store, a, aMonths)
+	checkRun(t, store, b, bMonths)
+	if months, err := store.FindRunMonths(orphan); err != nil || len(months) != 0 {
+		t.Fatalf("found %d months of the orphan run, error %v", len(months), err)
+	}
+
+	// Header and one save of each run
+	if count := countLines(t, filepath.Join(dir, "run_months.csv")); count != 1+len(aMonths)+len(bMonths) {
+		t.Fatalf("run_months.csv has %d lines after reopening, expected %d", count, 1+len(aMonths)+len(bMonths))
+	}
+	if count := countLines(t, filepath.Join(dir, "trades.csv")); count != 1+len(aTrades)+len(bTrades) {
+		t.Fatalf("trades.csv has %d lines after reopening, expected %d", count, 1+len(aTrades)+len(bTrades))
+	}
+
+	// Still appendable after compaction
+	c, cMonths, cTrades := testRun("USDJPY", 10)
+	if err := store.SaveRun(c, cMonths, cTrades); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = runner.OpenCSVStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	checkRun(t, store, c, cMonths)
+}
+
+func TestSQLiteDrawdownBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	store, err := runner.OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Equity 10, -20, -15 in January then -10, 40, 20 in February, from 0: run drawdown 35 (10 to -25)
+	r, months, _ := testRun("EURUSD", 0)
+	var trades []*backtesting.Trade
+	for i, pnl := range []float64{10, -30, 5, -10, 50, -20} {
+		open := time.Date(2023, time.Month(1+i/3), 2+i, 10, 0, 0, 0, time.UTC)
+		trades = append(trades, &backtesting.Trade{OpenTime: open, CloseTime: open.Add(time.Hour), PnL: pnl})
+	}
+	r.TotalTrades = len(trades)
+	if err := store.SaveRun(r, months, trades); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// As saved before migration 6
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("UPDATE runs SET max_drawdown = NULL; UPDATE run_months SET max_drawdown = NULL; PRAGMA user_version = 5;")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if store, err = runner.OpenSQLiteStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	found, err := store.FindRun(r.ComputeKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backfilled, err := store.FindRunMonths(r.ComputeKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.MaxDrawdown != 35 {
+		t.Errorf("run max drawdown %v, expected 35", found.MaxDrawdown)
+	}
+	for month, expected := range map[common.Month]float64{common.NewMonth(2023, 1): 30, common.NewMonth(2023, 2): 20} {
+		if backfilled[month].MaxDrawdown != expected {
+			t.Errorf("max drawdown of %s %v, expected %v", month, backfilled[month].MaxDrawdown, expected)
+		}
+	}
+}
+
+func checkRun(t *testing.T, store runner.Store, expected *runner.Run, expectedMonths map[common.Month]*backtesting.Metrics) {
+	t.Helper()
+
+	key := expected.ComputeKey()
+	found, err := store.FindRun(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil {
+		t.Fatalf("run %s not found", key)
+	}
+
+	want := *expected
+	want.Key = key
+	if !reflect.DeepEqual(*found, want) {
+		t.Fatalf("run %s differs:\ngot  %+v\nwant %+v", key, *found, want)
+	}
+
+	months, err := store.FindRunMonths(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(months, expectedMonths) {
+		t.Fatalf("months of run %s differ: got %d months, want %d", key, len(months), len(expectedMonths))
+	}
+}
+
+// appendOrphanRows copies the rows of the key under another key, without run row.
+func appendOrphanRows(t *testing.T, path, key, orphan string) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if rest, ok := strings.CutPrefix(line, key+","); ok {
+			rows = append(rows, orphan+","+rest+"\n")
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, row := range rows {
+		file.WriteString(row)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	count := 0
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		count++
+	}
+	return count
+}
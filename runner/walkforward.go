@@ -0,0 +1,182 @@
+package runner
+
+import (
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/gridsearch"
+	"math"
+)
+
+// WalkForwardWindow is an in-sample period on which combos are optimised, followed by the out-of-sample period
+// on which the best one is run.
+type WalkForwardWindow struct {
+	InSample    common.TimeRange
+	OutOfSample common.TimeRange
+}
+
+func (w WalkForwardWindow) String() string {
+	return fmt.Sprintf("%s -> %s", w.InSample, w.OutOfSample)
+}
+
+// WalkForwardWindows splits a month-aligned range into windows of inSample months followed by outOfSample months.
+// Windows move forward by outOfSample months, so that out-of-sample periods follow each other without overlap.
+// Rolling windows keep inSample months, anchored ones all begin with the range and grow.
+func WalkForwardWindows(timeRange common.TimeRange, inSample, outOfSample int, anchored bool) ([]WalkForwardWindow, error) {
+	if !timeRange.IsMonthAligned() {
+		return nil, fmt.Errorf("walk-forward range %s must cover whole months", timeRange)
+	}
+	if inSample <= 0 || outOfSample <= 0 {
+		return nil, fmt.Errorf("in-sample and out-of-sample periods must be at least one month")
+	}
+
+	months := timeRange.Months()
+	windows := make([]WalkForwardWindow, 0)
+	for start := 0; start+inSample+outOfSample <= len(months); start += outOfSample {
+		first := start
+		if anchored {
+			first = 0
+		}
+		split := start + inSample
+
+		windows = append(windows, WalkForwardWindow{
+			InSample:    common.MonthRange(months[first], months[split-1]),
+			OutOfSample: common.MonthRange(months[split], months[split+outOfSample-1]),
+		})
+	}
+
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("walk-forward range %s is shorter than %d in-sample and %d out-of-sample months", timeRange, inSample, outOfSample)
+	}
+	return windows, nil
+}
+
+type WalkForwardOptions struct {
+	Windows    []WalkForwardWindow
+	Search     func(window WalkForwardWindow) gridsearch.SearchStrategy // New search for each window
+	Batch      int                                                      // Number of combos proposed at a time, see OptimizeOptions
+	Spec       func(combo gridsearch.Combo, timeRange common.TimeRange) *RunSpec
+	Objectives []Objective // The best combo of a window is the best on the first objective among the Pareto front
+}
+
+type WalkForwardResult struct {
+	Windows []*WalkForwardWindowResult
+	Equity  []EquityPoint // Stitched out-of-sample PnL, month by month, flat over the windows whose best combo failed
+
+	// Efficiency is the out-of-sample PnL per month relative to the in-sample PnL per month of the best combos,
+	// NaN if the in-sample PnL is not positive. Robust strategies keep a good part of their in-sample performance.
+	// The out-of-sample months of failed windows count as months without PnL.
+	Efficiency float64
+}
+
+type WalkForwardWindowResult struct {
+	WalkForwardWindow
+	Best        gridsearch.Combo // Nil if no combo succeeded in-sample
+	Scores      []float64        // In-sample objectives of the best combo
+	InSample    *Run             // Run of the best combo on each period, nil if it failed
+	OutOfSample *Run
+	Efficiency  float64 // See WalkForwardResult.Efficiency
+}
+
+type EquityPoint struct {
+	Month  common.Month
+	PnL    float64 // Out-of-sample PnL of the month
+	Equity float64 // Cumulative out-of-sample PnL at the end of the month
+}
+
+// WalkForward optimises combos on each in-sample period, runs the best one on the following out-of-sample period,
+// and stitches the out-of-sample results. Runs completed earlier are found in the store instead of being run again.
+func (r *Runner) WalkForward(options *WalkForwardOptions) (*WalkForwardResult, error) {
+	result := &WalkForwardResult{}
+
+	var inSamplePnL, outOfSamplePnL float64
+	var inSampleMonths, outOfSampleMonths int
+
+	for i, window := range options.Windows {
+		log.Info("🚶 Window %d/%d: %s", i+1, len(options.Windows), window)
+
+		optimized, err := r.Optimize(&OptimizeOptions{
+			Search: options.Search(window),
+			Batch:  options.Batch,
+			Specs: func(combo gridsearch.Combo) []*RunSpec {
+				return []*RunSpec{options.Spec(combo, window.InSample)}
+			},
+			Objectives: options.Objectives,
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to optimise on %s: %w", window.InSample, err)
+		}
+
+		windowResult := &WalkForwardWindowResult{WalkForwardWindow: window, Efficiency: math.NaN()}
+		result.Windows = append(result.Windows, windowResult)
+		best := optimized.Best()
+		if best == nil {
+			log.Warning("No combo succeeded on %s", window.InSample)
+			result.appendEquity(window.OutOfSample, nil)
+			outOfSampleMonths += len(window.OutOfSample.Months())
+			continue
+		}
+		windowResult.Best, windowResult.Scores = best.Combo, best.Scores
+
+		if windowResult.InSample, err = r.FindRun(options.Spec(best.Combo, window.InSample)); err != nil {
+			return result, err
+		}
+
+		spec := options.Spec(best.Combo, window.OutOfSample)
+		if err := r.SubmitRun(spec); err != nil {
+			return result, err
+		}
+		if err := r.Wait(); err != nil {
+			return result, err
+		}
+		if windowResult.OutOfSample, err = r.FindRun(spec); err != nil {
+			return result, err
+		}
+		if windowResult.InSample == nil || windowResult.OutOfSample == nil {
+			log.Warning("Best combo of %s failed", window)
+			result.appendEquity(window.OutOfSample, nil)
+			outOfSampleMonths += len(window.OutOfSample.Months())
+			continue
+		}
+
+		months, err := r.store.FindRunMonths(windowResult.OutOfSample.Key)
+		if err != nil {
+			return result, fmt.Errorf("failed to find months of %s: %w", spec, err)
+		}
+		result.appendEquity(window.OutOfSample, months)
+
+		isMonths, oosMonths := len(window.InSample.Months()), len(window.OutOfSample.Months())
+		windowResult.Efficiency = efficiency(windowResult.InSample.NetPnL, isMonths, windowResult.OutOfSample.NetPnL, oosMonths)
+
+		inSamplePnL += windowResult.InSample.NetPnL
+		inSampleMonths += isMonths
+		outOfSamplePnL += windowResult.OutOfSample.NetPnL
+		outOfSampleMonths += oosMonths
+	}
+
+	result.Efficiency = efficiency(inSamplePnL, inSampleMonths, outOfSamplePnL, outOfSampleMonths)
+	return result, nil
+}
+
+// appendEquity stitches the months of an out-of-sample period, without PnL if they have no metrics.
+func (result *WalkForwardResult) appendEquity(outOfSample common.TimeRange, months map[common.Month]*backtesting.Metrics) {
+	for _, month := range outOfSample.Months() {
+		point := EquityPoint{Month: month}
+		if metrics, ok := months[month]; ok {
+			point.PnL = metrics.NetPnL
+		}
+		if n := len(result.Equity); n > 0 {
+			point.Equity = result.Equity[n-1].Equity
+		}
+		point.Equity += point.PnL
+		result.Equity = append(result.Equity, point)
+	}
+}
+
+// efficiency compares PnLs per month, so that periods of different lengths can be compared.
+func efficiency(inSamplePnL float64, inSampleMonths int, outOfSamplePnL float64, outOfSampleMonths int) float64 {
+	if inSamplePnL <= 0 || inSampleMonths == 0 || outOfSampleMonths == 0 {
+		return math.NaN()
+	}
+	return (outOfSamplePnL / float64(outOfSampleMonths)) / (inSamplePnL / float64(inSampleMonths))
+}
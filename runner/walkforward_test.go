@@ -0,0 +1,84 @@
+package runner_test
+
+import (
+	"context"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"go-experiments/common"
+	"go-experiments/gridsearch"
+	"go-experiments/runner"
+	"go-experiments/strategies"
+	"go-experiments/traders"
+	"testing"
+)
+
+// failingLoader has no data for one month.
+type failingLoader struct {
+	runner.DatasetLoader
+	missing common.Month
+}
+
+func (l failingLoader) Load(instrument string, month common.Month) (*backtesting.Dataset, error) {
+	if month == l.missing {
+		return nil, fmt.Errorf("no data for %s", month)
+	}
+	return l.DatasetLoader.Load(instrument, month)
+}
+
+func TestWalkForwardFailedWindows(t *testing.T) {
+	first, last := common.NewMonth(2023, 1), common.NewMonth(2023, 4)
+	windows, err := runner.WalkForwardWindows(common.MonthRange(first, last), 1, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// March fails both out-of-sample in the second window and in-sample in the third
+	synthetic := runner.SyntheticLoader(map[string]*backtesting.SyntheticConfig{
+		"SYN": backtesting.DefaultSyntheticConfig("SYN", first, last, 1),
+	})
+	r, err := runner.NewRunnerWithOptions(context.Background(), &runner.Options{
+		Store:  runner.NewMemoryStore(),
+		Loader: failingLoader{DatasetLoader: synthetic, missing: common.NewMonth(2023, 3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	space := strategies.BreakoutSpace
+	result, err := r.WalkForward(&runner.WalkForwardOptions{
+		Windows: windows,
+		Search: func(window runner.WalkForwardWindow) gridsearch.SearchStrategy {
+			return gridsearch.RandomSearch(space, 2, 1)
+		},
+		Spec: func(combo gridsearch.Combo, timeRange common.TimeRange) *runner.RunSpec {
+			spec := runner.NewRunSpec("SYN", timeRange, traders.ModularSpec(strategies.BreakoutBuilder(combo)))
+			spec.Params = combo
+			return spec
+		},
+		Objectives: []runner.Objective{runner.Objectives["net-pnl"]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Windows) != 3 || result.Windows[0].OutOfSample == nil {
+		t.Fatalf("expected 3 windows, the first succeeding, got %+v", result.Windows)
+	}
+	for _, window := range result.Windows[1:] {
+		if window.OutOfSample != nil {
+			t.Errorf("window %s succeeded out-of-sample", window)
+		}
+	}
+
+	// Flat after February
+	if len(result.Equity) != 3 {
+		t.Fatalf("expected 3 months of equity, got %+v", result.Equity)
+	}
+	february := result.Equity[0]
+	for i, point := range result.Equity[1:] {
+		if point.Month != common.NewMonth(2023, 3+i) || point.PnL != 0 || point.Equity != february.Equity {
+			t.Errorf("expected no PnL in %s after %v, got %+v", point.Month, february, point)
+		}
+	}
+}
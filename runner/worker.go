@@ -0,0 +1,215 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-experiments/brokers/backtesting"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	workerRetryDelay   = 5 * time.Second
+	workerPostAttempts = 5
+)
+
+// Worker pulls runs from a Coordinator, runs them on datasets of its own catalog and posts the results back.
+type Worker struct {
+	url      string
+	client   *http.Client
+	datasets *datasets
+}
+
+// NewWorker creates a worker for the coordinator at the given base URL, e.g. http://localhost:8080.
+// Datasets are loaded with the loader and cached within the budget in bytes (0 for the default budget).
+func NewWorker(coordinatorURL string, loader DatasetLoader, cacheBudget int64) *Worker {
+	return &Worker{
+		url:      strings.TrimSuffix(coordinatorURL, "/"),
+		client:   &http.Client{Timeout: 2 * pollTimeout},
+		datasets: newDatasets(loader, cacheBudget),
+	}
+}
+
+// Run processes runs concurrently until ctx is canceled. Runs in progress are abandoned, their leases expire.
+func (w *Worker) Run(ctx context.Context, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warning("Failed to get next run from coordinator: %v", err)
+				sleep(ctx, workerRetryDelay)
+			}
+			continue
+		}
+		if job == nil {
+			continue // No run available yet
+		}
+
+		result := w.execute(job)
+		if ctx.Err() != nil {
+			return // Possibly interrupted, let the lease expire
+		}
+
+		if err := w.post(ctx, job, result); err != nil {
+			log.Error("❌ Failed to post result of %s: %v", job.Spec, err)
+		}
+		if result.Refused != "" {
+			sleep(ctx, workerRetryDelay) // Let other workers take the run
+		}
+	}
+}
+
+// execute runs the job, turning errors and panics into a failed result.
+func (w *Worker) execute(job *Job) (result *JobResult) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			result = &JobResult{Checksum: job.Checksum, Error: fmt.Sprintf("panic: %v\n%s", rec, debug.Stack())}
+		}
+	}()
+
+	spec := job.Spec
+	log.Info("Running strategy for %s: %s", spec, spec.Trader.Format().Compact())
+
+	checksum, err := w.datasets.RangeChecksum(spec.Instrument, spec.TimeRange, spec.Broker.Candles)
+	if err != nil {
+		log.Warning("🙅 Refused %s: %v", spec, err)
+		return &JobResult{Refused: fmt.Sprintf("failed to get dataset checksum: %v", err)}
+	}
+	if checksum != job.Checksum {
+		log.Warning("🙅 Refused %s: dataset checksum %s does not match %s", spec, checksum, job.Checksum)
+		return &JobResult{Checksum: checksum, Refused: fmt.Sprintf("dataset checksum %s does not match %s", checksum, job.Checksum)}
+	}
+
+	broker, err := newBroker(w.datasets, spec)
+	if err != nil {
+		return &JobResult{Checksum: checksum, Error: err.Error()}
+	}
+
+	runResult, err := runBacktest(broker, spec)
+	var aborted *backtesting.AbortedError
+	if errors.As(err, &aborted) {
+		log.Info("Run pruned for %s (%s): %s", spec, aborted, spec.Trader.Format().Compact())
+		return &JobResult{Checksum: checksum, Aborted: aborted}
+	}
+	if err != nil {
+		return &JobResult{Checksum: checksum, Error: err.Error()}
+	}
+
+	result = &JobResult{
+		Checksum: checksum,
+		Metrics:  runResult.Metrics,
+		Months:   make(map[string]*backtesting.Metrics, len(runResult.Months)),
+		Trades:   runResult.Trades,
+	}
+	for month, metrics := range runResult.Months {
+		result.Months[month.String()] = metrics
+	}
+
+	log.Info("Run completed for %s: %s", spec, spec.Trader.Format().Compact())
+	return result
+}
+
+// next long-polls the coordinator, returning nil if no run came in time.
+func (w *Worker) next(ctx context.Context) (*Job, error) {
+	response, err := w.request(ctx, w.url+"/jobs/next", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		var job Job
+		if err := json.NewDecoder(response.Body).Decode(&job); err != nil {
+			return nil, fmt.Errorf("invalid job: %w", err)
+		}
+		return &job, nil
+	case http.StatusNoContent:
+		return nil, nil
+	default:
+		return nil, unexpectedStatus(response)
+	}
+}
+
+// post sends the result, retrying on network errors.
+func (w *Worker) post(ctx context.Context, job *Job, result *JobResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to serialize result: %w", err)
+	}
+
+	url := w.url + "/jobs/" + job.ID + "/result"
+	for attempt := 1; ; attempt++ {
+		response, err := w.request(ctx, url, body)
+		if err == nil {
+			defer response.Body.Close()
+
+			switch response.StatusCode {
+			case http.StatusNoContent, http.StatusOK:
+				return nil
+			case http.StatusGone:
+				log.Info("Result of %s ignored by coordinator: lease expired", job.Spec)
+				return nil
+			default:
+				return unexpectedStatus(response)
+			}
+		}
+
+		if attempt == workerPostAttempts || ctx.Err() != nil {
+			return err
+		}
+		log.Warning("Failed to post result of %s (attempt %d): %v", job.Spec, attempt, err)
+		sleep(ctx, workerRetryDelay)
+	}
+}
+
+func (w *Worker) request(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	return w.client.Do(request)
+}
+
+func unexpectedStatus(response *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("unexpected status %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
+
+// sleep waits for the duration, returning false if ctx was canceled first.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"go-experiments/traders/modular"
 	"go-experiments/traders/modular/conditions"
 	"go-experiments/traders/modular/indicators"
+	"go-experiments/traders/modular/ordercomputer"
 	"time"
 )
 
@@ -69,19 +70,41 @@ func Breakout(strategy modular.StrategyBuilder) {
 // - TakeProfit ratio
 //
 // 4. Optional trend filter
-// - EMA200 trend filter: enabled or disabled
-
-var BreakoutSpace = gridsearch.ParameterSpace{
-	"RSIPeriod":      {7, 14, 21},
-	"RSILower":       {25.0, 30.0, 35.0},
-	"RSIUpper":       {65.0, 70.0, 75.0},
-	"ADXPeriod":      {7, 14, 21},
-	"ADXThreshold":   {15.0, 20.0, 25.0},
-	"ShortEMAPeriod": {5, 8, 10},
-	"LongEMAPeriod":  {20, 30, 50},
-	"TradeDays":      {"TueThu", "MonFri"},
-	// "Session":        {"London", "NewYork", "Both"},
-	"TrendFilter": {true, false},
+// - EMA trend filter: enabled or disabled
+// - EMA trend period (e.g., 200, 100), only varied when the filter is enabled
+
+var BreakoutSpace = gridsearch.NewParameterSpace().
+	Add("RSIPeriod", gridsearch.IntRange(7, 21, 7)...).
+	Declare(gridsearch.ParameterSchema{Name: "RSILower", Type: gridsearch.ParameterFloat, Min: 0, Max: 100}, 25, 30, 35).
+	Declare(gridsearch.ParameterSchema{Name: "RSIUpper", Type: gridsearch.ParameterFloat, Min: 0, Max: 100}, 65, 70, 75).
+	Add("ADXPeriod", gridsearch.IntRange(7, 21, 7)...).
+	Declare(gridsearch.ParameterSchema{Name: "ADXThreshold", Type: gridsearch.ParameterFloat, Min: 0, Max: 100}, 15, 20, 25).
+	Add("ShortEMAPeriod", 5, 8, 10).
+	Add("LongEMAPeriod", 20, 30, 50).
+	Add("TradeDays", "TueThu", "MonFri").
+	// Add("Session", "London", "NewYork", "Both").
+	Add("TrendFilter", true, false).
+	AddConditional("TrendEMAPeriod", func(c gridsearch.Combo) bool { return c.Bool("TrendFilter") }, 200, 100).
+	Constrain(func(c gridsearch.Combo) bool { return c.Int("ShortEMAPeriod") < c.Int("LongEMAPeriod") })
+
+// BreakoutBuilder builds the trader of a combo of BreakoutSpace, as run by sweeps.
+func BreakoutBuilder(c gridsearch.Combo) modular.Builder {
+	builder := modular.NewBuilder()
+	builder.SetHistorySize(250)
+
+	BreakoutGS(builder.Strategy(), c)
+
+	builder.RiskManager().SetStopLoss(
+		ordercomputer.StopLossATR(indicators.ATR(14), 1.0),
+	).SetTakeProfit(
+		ordercomputer.TakeProfitRatio(2.0),
+	)
+
+	builder.CapitalAllocator().SetAllocator(
+		ordercomputer.CapitalFixed(10),
+	)
+
+	return builder
 }
 
 func BreakoutGS(strategy modular.StrategyBuilder, c gridsearch.Combo) {
@@ -112,8 +135,8 @@ func BreakoutGS(strategy modular.StrategyBuilder, c gridsearch.Combo) {
 	var trendShort conditions.Condition
 
 	if c.Bool("TrendFilter") {
-		trendLong = conditions.PriceThreshold(indicators.EMA(200), conditions.Above)
-		trendShort = conditions.PriceThreshold(indicators.EMA(200), conditions.Below)
+		trendLong = conditions.PriceThreshold(indicators.EMA(c.Int("TrendEMAPeriod")), conditions.Above)
+		trendShort = conditions.PriceThreshold(indicators.EMA(c.Int("TrendEMAPeriod")), conditions.Below)
 	} else {
 		trendLong = conditions.True()
 		trendShort = conditions.True()
@@ -0,0 +1,132 @@
+package traders
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-experiments/brokers"
+	"go-experiments/traders/modular"
+	"go-experiments/traders/modular/formatter"
+	"go-experiments/traders/modular/marshal"
+)
+
+// Spec describes a trader, so that it can be set up on any number of brokers, serialized and cached.
+type Spec interface {
+	formatter.Formatter
+	marshal.ToJsonSpec
+
+	Setup(broker brokers.Broker) error
+}
+
+var specRegistry = marshal.NewRegistry[Spec]()
+
+func init() {
+	specRegistry.RegisterParser("basic", func(arg json.RawMessage) (Spec, error) {
+		return BasicSpec(), nil
+	})
+
+	specRegistry.RegisterParser("gpt", func(arg json.RawMessage) (Spec, error) {
+		var config GptConfig
+		if err := json.Unmarshal(arg, &config); err != nil {
+			return nil, err
+		}
+		return GptSpec(&config), nil
+	})
+
+	specRegistry.RegisterParser("modular", func(arg json.RawMessage) (Spec, error) {
+		builder, err := modular.FromJSON(arg)
+		if err != nil {
+			return nil, err
+		}
+		return ModularSpec(builder), nil
+	})
+}
+
+// SpecFromJSON parses a spec serialized by SpecToJSON, or a modular builder serialized alone as runs were stored before
+// specs.
+func SpecFromJSON(jsonData []byte) (Spec, error) {
+	spec, err := specRegistry.FromJSON(jsonData)
+	if err != nil {
+		if builder, builderErr := modular.FromJSON(jsonData); builderErr == nil {
+			return ModularSpec(builder), nil
+		}
+	}
+	return spec, err
+}
+
+func SpecToJSON(spec Spec) string {
+	return string(marshal.ToJSON(spec))
+}
+
+func BasicSpec() Spec {
+	return newSpec(
+		func(broker brokers.Broker) error {
+			SetupBasicTrader(broker)
+			return nil
+		},
+		func() *formatter.FormatterNode {
+			return formatter.Format("BasicTrader")
+		},
+		func() (string, any) {
+			return "basic", nil
+		},
+	)
+}
+
+func GptSpec(config *GptConfig) Spec {
+	return newSpec(
+		func(broker brokers.Broker) error {
+			SetupGptTrader(broker, config)
+			return nil
+		},
+		func() *formatter.FormatterNode {
+			return formatter.Format(fmt.Sprintf("GptTrader%+v", *config))
+		},
+		func() (string, any) {
+			return "gpt", config
+		},
+	)
+}
+
+func ModularSpec(builder modular.Builder) Spec {
+	return newSpec(
+		func(broker brokers.Broker) error {
+			return SetupModularTrader(broker, builder)
+		},
+		func() *formatter.FormatterNode {
+			return builder.Format()
+		},
+		func() (string, any) {
+			return "modular", json.RawMessage(modular.ToJSON(builder))
+		},
+	)
+}
+
+func newSpec(
+	setup func(broker brokers.Broker) error,
+	format func() *formatter.FormatterNode,
+	toJsonSpec func() (string, any),
+) Spec {
+	return &spec{
+		setup:      setup,
+		format:     format,
+		toJsonSpec: toJsonSpec,
+	}
+}
+
+type spec struct {
+	setup      func(broker brokers.Broker) error
+	format     func() *formatter.FormatterNode
+	toJsonSpec func() (string, any)
+}
+
+func (s *spec) Setup(broker brokers.Broker) error {
+	return s.setup(broker)
+}
+
+func (s *spec) Format() *formatter.FormatterNode {
+	return s.format()
+}
+
+func (s *spec) ToJsonSpec() (string, any) {
+	return s.toJsonSpec()
+}